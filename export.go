@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/tesserato/DSBG/src/parse"
+)
+
+// parseInterspersed parses flags that may appear before or after positional arguments,
+// which the flag package alone stops at, and returns the positional arguments.
+func parseInterspersed(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flagSet.Parse(args); err != nil {
+			return nil, err
+		}
+		if flagSet.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flagSet.Arg(0))
+		args = flagSet.Args()[1:]
+	}
+}
+
+// Export formats.
+const (
+	exportSingleFile = "single-file"
+	exportEpub       = "epub"
+)
+
+// runExport implements "dsbg export": instead of building the website, it renders one
+// article, or a selection of the articles of the input directory, into a single
+// standalone document.
+func runExport(args []string) {
+	flagSet := flag.NewFlagSet("dsbg export", flag.ExitOnError)
+
+	var settings parse.Settings
+	sf := defineSiteFlags(flagSet, &settings)
+	singleFile := flagSet.Bool("single-file", false, "Export one self-contained HTML file, with the theme CSS, scripts and images inlined as data URIs.")
+	outFile := flagSet.String("file", "", "Path of the exported file. Defaults to the article's file name (or the site title) in the current directory.")
+	tagFilter := flagSet.String("tag", "", "Only export articles with one of these comma-separated tags.")
+	folderFilter := flagSet.String("folder", "", "Only export articles from this folder of the input directory.")
+
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintf(os.Stderr, "%sDSBG EXPORT%s\n", cBold+cCyan, cReset)
+		fmt.Fprintln(os.Stderr, "Exports one article, or a selection of the site's articles (all by default), as a standalone document.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintf(os.Stderr, "%sUSAGE:%s\n", cBold+cYellow, cReset)
+		fmt.Fprintln(os.Stderr, "  dsbg export -single-file [flags] [article.md]")
+		fmt.Fprintln(os.Stderr, "  dsbg export epub [flags] [article.md]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintf(os.Stderr, "%sEXPORT OPTIONS:%s\n", cBold+cWhite, cReset)
+		for _, name := range []string{"single-file", "file", "tag", "folder"} {
+			printFlagHelp(flagSet.Lookup(name))
+		}
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "  All content and theming flags of the build (e.g. -input, -title, -author, -logo, -lang,")
+		fmt.Fprintln(os.Stderr, "  -sort, -mathml) are accepted as well. Run 'dsbg -h' to list them.")
+		fmt.Fprintln(os.Stderr)
+	}
+
+	positional, err := parseInterspersed(flagSet, args)
+	if err != nil {
+		log.Fatalf("Error parsing flags: %v", err)
+	}
+	format := ""
+	if *singleFile {
+		format = exportSingleFile
+	}
+	if len(positional) > 0 && positional[0] == exportEpub {
+		if format != "" {
+			log.Fatal("Choose a single export format: -single-file or epub.")
+		}
+		format = exportEpub
+		positional = positional[1:]
+	}
+	if format == "" {
+		flagSet.Usage()
+		log.Fatal("No export format selected. Use -single-file or epub.")
+	}
+	if len(positional) > 1 {
+		log.Fatalf("Expected at most one article to export, got %d: %s", len(positional), strings.Join(positional, ", "))
+	}
+
+	if err := sf.apply(&settings); err != nil {
+		log.Fatal(err)
+	}
+	templates, err := parse.LoadTemplates(assets)
+	if err != nil {
+		log.Fatalf("Error loading templates: %v", err)
+	}
+
+	var files []string
+	if len(positional) == 1 {
+		files = positional
+		// An article outside the input directory is read relative to its own folder,
+		// so no tags are derived from unrelated parent folders.
+		if rel, err := filepath.Rel(settings.InputPath, positional[0]); err != nil || strings.HasPrefix(rel, "..") {
+			settings.InputPath = filepath.Dir(positional[0])
+		}
+	} else {
+		root := filepath.Join(settings.InputPath, *folderFilter)
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			log.Fatalf("Input directory '%s' does not exist.", root)
+		}
+		files, err = parse.GetPaths(root, []string{".md", ".html"})
+		if err != nil {
+			log.Fatalf("error getting content files: %v", err)
+		}
+	}
+
+	if settings.Obsidian {
+		if settings.Vault, err = parse.NewVault(settings); err != nil {
+			log.Fatalf("Error indexing content files: %v", err)
+		}
+	}
+
+	articles, resources, err := exportArticles(files, settings)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *tagFilter != "" {
+		articles = filterByTags(articles, strings.Split(*tagFilter, ","))
+	}
+	if len(articles) == 0 {
+		log.Fatalf("No articles to export in '%s'.", settings.InputPath)
+	}
+	parse.SortArticles(articles, settings.Sort)
+
+	// A single article is exported under its own title, a selection under the site title.
+	title := settings.Title
+	name := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(settings.Title)), " ", "-")
+	if len(positional) == 1 {
+		title = articles[0].Title
+		name = strings.TrimSuffix(filepath.Base(positional[0]), filepath.Ext(positional[0]))
+	}
+	destPath := *outFile
+
+	switch format {
+	case exportSingleFile:
+		for i := range articles {
+			articles[i].BodyContent, err = parse.InlineResources(articles[i], resources[articles[i].OriginalPath], settings)
+			if err != nil {
+				log.Fatalf("error exporting file %s: %v", articles[i].OriginalPath, err)
+			}
+		}
+		content, err := parse.SingleFileHTML(articles, settings, templates.SingleFile, assets)
+		if err != nil {
+			log.Fatalf("error exporting single file: %v", err)
+		}
+		if settings.Minify {
+			if content, err = parse.MinifyContent("export.html", content); err != nil {
+				log.Fatalf("error minifying export: %v", err)
+			}
+		}
+		if destPath == "" {
+			destPath = name + ".html"
+		}
+		if err := os.WriteFile(destPath, content, 0644); err != nil {
+			log.Fatalf("error writing '%s': %v", destPath, err)
+		}
+	case exportEpub:
+		book := parse.NewEpub(title, settings)
+		for _, article := range articles {
+			if err := book.AddArticle(article, resources[article.OriginalPath]); err != nil {
+				log.Fatalf("error exporting file %s: %v", article.OriginalPath, err)
+			}
+		}
+		if destPath == "" {
+			destPath = name + ".epub"
+		}
+		if err := book.Write(destPath, templates.Epub, assets); err != nil {
+			log.Fatalf("error exporting EPUB: %v", err)
+		}
+	}
+	log.Printf("Exported %d article(s) to %s", len(articles), destPath)
+}
+
+// exportArticles reads the given source files, returning the articles and the resources
+// referenced by each, keyed by source path. The custom 404 page is left out of
+// multi-file exports.
+func exportArticles(files []string, settings parse.Settings) ([]parse.Article, map[string][]string, error) {
+	var articles []parse.Article
+	resources := map[string][]string{}
+	for _, filePath := range files {
+		if len(files) > 1 {
+			if rel, err := filepath.Rel(settings.InputPath, filePath); err == nil && parse.IsNotFoundSource(rel) {
+				continue
+			}
+		}
+		article, articleResources, err := parse.ReadArticle(filePath, settings)
+		if err != nil {
+			if !settings.IgnoreErrors {
+				return nil, nil, fmt.Errorf("error exporting file %s: %v", filePath, err)
+			}
+			log.Printf("Warning: Skipping file %s due to error: %v\n", filePath, err)
+			continue
+		}
+		articles = append(articles, article)
+		resources[article.OriginalPath] = articleResources
+	}
+	return articles, resources, nil
+}
+
+// filterByTags returns the articles having at least one of tags, compared case-insensitively.
+func filterByTags(articles []parse.Article, tags []string) []parse.Article {
+	var filtered []parse.Article
+	for _, article := range articles {
+		if slices.ContainsFunc(article.Tags, func(tag string) bool {
+			return slices.ContainsFunc(tags, func(wanted string) bool {
+				return strings.EqualFold(strings.TrimSpace(wanted), strings.TrimSpace(tag))
+			})
+		}) {
+			filtered = append(filtered, article)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tesserato/DSBG/src/parse"
+)
+
+// Import sources.
+const (
+	importWordPress = "wordpress"
+	importJekyll    = "jekyll"
+	importHugo      = "hugo"
+)
+
+// runImport implements "dsbg import": it converts the content of another blogging
+// platform into Markdown files that DSBG can build.
+func runImport(args []string) {
+	flagSet := flag.NewFlagSet("dsbg import", flag.ExitOnError)
+
+	var opts parse.ImportOptions
+	flagSet.StringVar(&opts.OutputPath, "output", "content", "Directory the Markdown files are written to, typically the input directory of the site.")
+	flagSet.StringVar(&opts.MediaPath, "media", "", "WordPress only: directory holding a copy of wp-content/uploads. Referenced files are copied and linked locally.")
+	flagSet.BoolVar(&opts.Overwrite, "overwrite", false, "Replace existing files in the output directory.")
+
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintf(os.Stderr, "%sDSBG IMPORT%s\n", cBold+cCyan, cReset)
+		fmt.Fprintln(os.Stderr, "Converts the content of another blogging platform into Markdown files with DSBG frontmatter.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintf(os.Stderr, "%sUSAGE:%s\n", cBold+cYellow, cReset)
+		fmt.Fprintln(os.Stderr, "  dsbg import wordpress [flags] export.xml")
+		fmt.Fprintln(os.Stderr, "  dsbg import jekyll [flags] site-directory")
+		fmt.Fprintln(os.Stderr, "  dsbg import hugo [flags] site-directory")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintf(os.Stderr, "%sIMPORT OPTIONS:%s\n", cBold+cWhite, cReset)
+		for _, name := range []string{"output", "media", "overwrite"} {
+			printFlagHelp(flagSet.Lookup(name))
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+
+	positional, err := parseInterspersed(flagSet, args)
+	if err != nil {
+		log.Fatalf("Error parsing flags: %v", err)
+	}
+	if len(positional) != 2 {
+		flagSet.Usage()
+		log.Fatal("Expected a source platform and the path of its export or site.")
+	}
+	source, sourcePath := positional[0], positional[1]
+	if opts.MediaPath != "" {
+		if info, err := os.Stat(opts.MediaPath); err != nil || !info.IsDir() {
+			log.Fatalf("Media directory '%s' does not exist.", opts.MediaPath)
+		}
+	}
+	if err := os.MkdirAll(opts.OutputPath, 0755); err != nil {
+		log.Fatalf("Error creating output directory '%s': %v", opts.OutputPath, err)
+	}
+
+	var report parse.ImportReport
+	switch strings.ToLower(source) {
+	case importWordPress:
+		report, err = parse.ImportWordPress(sourcePath, opts)
+	case importJekyll:
+		report, err = parse.ImportJekyll(sourcePath, opts)
+	case importHugo:
+		report, err = parse.ImportHugo(sourcePath, opts)
+	default:
+		log.Fatalf("Unknown import source '%s'. Supported: %s, %s, %s.", source, importWordPress, importJekyll, importHugo)
+	}
+	if err != nil {
+		log.Fatalf("Error importing from %s: %v", source, err)
+	}
+	log.Printf("Imported %d post(s) and %d page(s) into %s, copying %d file(s); skipped %d unpublished entries.", report.Posts, report.Pages, opts.OutputPath, report.Files, report.Skipped)
+}
@@ -10,11 +10,13 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
-	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +25,8 @@ import (
 	"github.com/tesserato/DSBG/src/parse"
 )
 
+//go:generate go run ./tools/vendorlibs -out src/assets/vendor
+
 //go:embed src/assets
 var assets embed.FS
 
@@ -72,6 +76,31 @@ func (s *shareButtonsFlag) Set(value string) error {
 	return nil
 }
 
+// permalinksFlag is a custom flag type that collects repeated -permalink-dir flags.
+type permalinksFlag map[string]string
+
+// String returns a human-readable description of the permalinksFlag format.
+func (p *permalinksFlag) String() string {
+	return "Per-folder permalink patterns defined by folder=pattern"
+}
+
+// Set parses and adds a folder=pattern value to permalinksFlag.
+func (p *permalinksFlag) Set(value string) error {
+	folder, pattern, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("invalid permalink format. Expected 'folder=pattern', got '%s'", value)
+	}
+	if err := parse.ValidatePermalink(strings.TrimSpace(pattern)); err != nil {
+		return err
+	}
+	folder = path.Clean(strings.Trim(filepath.ToSlash(strings.TrimSpace(folder)), "/"))
+	if *p == nil {
+		*p = permalinksFlag{}
+	}
+	(*p)[folder] = strings.TrimSpace(pattern)
+	return nil
+}
+
 // noFlagsPassed reports whether any flags were set in the provided FlagSet.
 func noFlagsPassed(fs *flag.FlagSet) bool {
 	found := false
@@ -95,15 +124,22 @@ func printFlagHelp(f *flag.Flag) {
 	fmt.Fprintf(os.Stderr, "  %s%-24s%s%s%s\n    %s\n", cGreen, name, cGray, def, cReset, f.Usage)
 }
 
-// main is the entrypoint for DSBG (Dead Simple Blog Generator).
-func main() {
-	flagSet := flag.NewFlagSet("dsbg", flag.ExitOnError)
-
-	var settings parse.Settings
-	var shareButtons shareButtonsFlag
+// siteFlags holds the flag values that need processing before they are stored in
+// parse.Settings. It is shared by the build and export commands.
+type siteFlags struct {
+	shareButtons        shareButtonsFlag
+	directoryPermalinks permalinksFlag
+	csp                 *string
+	hosting             *string
+	sort                *string
+	elementsTop         *string
+	elementsBottom      *string
+}
 
-	// Generate a simple cache-busting version based on startup time
-	settings.BuildVersion = fmt.Sprintf("%d", time.Now().Unix())
+// defineSiteFlags registers the flags that configure site generation on flagSet,
+// storing plain values directly in settings.
+func defineSiteFlags(flagSet *flag.FlagSet, settings *parse.Settings) *siteFlags {
+	sf := &siteFlags{}
 
 	// Prepare dynamic theme list for help text
 	themeDesc := "Selects one of the built-in themes."
@@ -114,10 +150,20 @@ func main() {
 	// --- General Config ---
 	flagSet.StringVar(&settings.Title, "title", "Blog", "The main title of your website. Used in the browser tab, header, and RSS feed.")
 	flagSet.StringVar(&settings.BaseUrl, "base-url", "", "The public URL (e.g., https://example.com). Essential for generating correct Canonical URLs, RSS feeds, and Open Graph social meta tags.")
+	flagSet.StringVar(&settings.BasePath, "base-path", "", "Subpath the site is served under (e.g. /blog for https://org.github.io/blog/). Derived from -base-url when it contains a path.")
 	flagSet.StringVar(&settings.InputPath, "input", "content", "Directory containing your source Markdown (.md) or HTML files.")
 	flagSet.StringVar(&settings.OutputPath, "output", "public", "Directory where the generated static site will be saved.")
 	flagSet.BoolVar(&settings.ForceOverwrite, "overwrite", false, "Skip the confirmation prompt when the output directory is not empty.")
 	flagSet.BoolVar(&settings.IgnoreErrors, "ignore-errors", false, "Log warnings instead of failing on missing resources, missing themes, or invalid dates.")
+	flagSet.BoolVar(&settings.SRI, "sri", false, "Add Subresource Integrity (integrity=\"sha384-...\") attributes to every script and stylesheet.")
+	sf.csp = flagSet.String("csp", "", "Generate a Content-Security-Policy. Options: meta (<meta http-equiv> in each page), headers (_headers file), both.")
+	flagSet.BoolVar(&settings.Minify, "minify", false, "Minify generated HTML, CSS and JavaScript. Whitespace inside <pre> is preserved and inline scripts are left untouched.")
+	flagSet.BoolVar(&settings.Precompress, "precompress", false, "Write .gz and .br versions of compressible files (HTML, CSS, JS, JSON, XML, SVG) for servers that serve precompressed files.")
+	flagSet.IntVar(&settings.PrecompressMinSize, "precompress-min-size", parse.DefaultPrecompressMinSize, "Smallest file size, in bytes, that gets precompressed siblings (used with -precompress).")
+	sf.hosting = flagSet.String("hosting", "", "Generate hosting configuration (redirects, caching and security headers, 404 page). Comma-separated: netlify, cloudflare, apache, nginx, or all.")
+	flagSet.StringVar(&settings.RedirectsCSVPath, "redirects", "", "Path to a CSV file of redirects ('from,to[,status]'), e.g. for URLs changed by a migration. Merged with article aliases.")
+	flagSet.BoolVar(&settings.Portable, "portable", false, "Make the output browsable from disk (file://) or a zip: relative links only and a search index loaded via <script>. Combine with -offline for no network access at all.")
+	flagSet.BoolVar(&settings.Offline, "offline", false, "Serve third-party libraries (search, MathJax) from the output directory instead of CDNs, for intranet or offline deployments.")
 
 	flagSet.StringVar(&settings.DescriptionMarkdown, "description", "This is my blog", "A short summary of your site. Rendered as Markdown on the homepage (supports links); stripped to plain text for SEO tags.")
 	flagSet.StringVar(&settings.Lang, "lang", "en", "The language code for the HTML <html> tag (e.g., 'en', 'es', 'fr').")
@@ -134,23 +180,163 @@ func main() {
 	flagSet.StringVar(&settings.PathToCustomCss, "css-path", "", "Path to a local CSS file. If set, this REPLACES the built-in theme entirely.")
 	flagSet.StringVar(&settings.PathToCustomJs, "js-path", "", "Path to a local JS file. Appended to the site's default functionality.")
 	flagSet.StringVar(&settings.PathToCustomFavicon, "favicon-path", "", "Path to a local 'favicon.ico' file to replace the default icon.")
-	flagSet.Var(&shareButtons, "share", "Add a custom share button. Format: 'Name|Icon.svg|URL_Template'. Can be used multiple times. See variables below.")
+	flagSet.Var(&sf.shareButtons, "share", "Add a custom share button. Format: 'Name|Icon.svg|URL_Template'. Can be used multiple times. See variables below.")
 
 	// --- Injections ---
-	pathToAdditionalElementsTop := flagSet.String("elements-top", "", "Path to an HTML snippet to inject at the top of the <head> tag (e.g., Analytics scripts).")
-	pathToAdditionalElementsBottom := flagSet.String("elements-bottom", "", "Path to an HTML snippet to inject at the bottom of the <body> tag (e.g., Comment widgets).")
+	sf.elementsTop = flagSet.String("elements-top", "", "Path to an HTML snippet to inject at the top of the <head> tag (e.g., Analytics scripts).")
+	sf.elementsBottom = flagSet.String("elements-bottom", "", "Path to an HTML snippet to inject at the bottom of the <body> tag (e.g., Comment widgets).")
 
 	// --- Behavior Toggles ---
-	sortFlag := flagSet.String("sort", "date-created", "Order of articles on the homepage. Options: date-created, date-updated, title, path (prefix with 'reverse-' to flip).")
+	sf.sort = flagSet.String("sort", "date-created", "Order of articles on the homepage. Options: date-created, date-updated, title, path (prefix with 'reverse-' to flip).")
 	flagSet.BoolVar(&settings.DoNotExtractTagsFromPaths, "ignore-tags-from-paths", false, "If true, folder names in the source path (e.g., content/linux/...) are NOT added as tags.")
 	flagSet.BoolVar(&settings.DoNotRemoveDateFromPaths, "keep-date-in-paths", false, "If true, date patterns in filenames (2023-01-01-post.md) are preserved in the output URL.")
 	flagSet.BoolVar(&settings.DoNotRemoveDateFromTitles, "keep-date-in-titles", false, "If true, date patterns in filenames are preserved in the Article Title string.")
+	flagSet.StringVar(&settings.Permalink, "permalink", "", "URL pattern for articles, e.g. '/:year/:month/:slug/', '/:section/:slug/' or '/posts/:slug.html'. Placeholders: :year, :month, :day, :slug, :section, :path. Defaults to the source path.")
+	flagSet.Var(&sf.directoryPermalinks, "permalink-dir", "Permalink pattern for one folder of the input directory. Format: 'folder=pattern'. Can be used multiple times; overrides -permalink.")
 	flagSet.BoolVar(&settings.OpenInNewTab, "open-in-new-tab", false, "If true, clicking articles on the homepage opens them in a new browser tab/window.")
+	flagSet.IntVar(&settings.RelatedCount, "related", parse.DefaultRelatedCount, "Number of related posts listed at the end of each article, ranked by shared tags and similar text. 0 lists only the ones pinned with 'related' frontmatter.")
+	flagSet.BoolVar(&settings.Obsidian, "obsidian", false, "Parse Obsidian vault syntax: [[wikilinks]] and ![[embeds]] resolved anywhere in the input directory, relative links to .md files, > [!note] callouts and inline #tags.")
+	flagSet.BoolVar(&settings.RenderMathML, "mathml", false, "Render $inline$ and $$display$$ math to MathML at build time. Unsupported constructs fall back to client-side MathJax, loaded only on pages that need it.")
+
+	// --- Extra Outputs ---
+	flagSet.BoolVar(&settings.Gemini, "gemini", false, "Also generate a Gemini capsule in the 'gemini' folder of the output: every Markdown article as gemtext, an index.gmi and an Atom feed.")
+	flagSet.StringVar(&settings.GeminiUrl, "gemini-url", "", "The public gemini:// URL of the capsule, used in its Atom feed. Defaults to the host of -base-url.")
+	flagSet.BoolVar(&settings.Markdown, "markdown", false, "Also write each Markdown article's source next to its page (index.md, frontmatter stripped, links absolute), plus llms.txt and llms-full.txt for machine readers.")
+	flagSet.BoolVar(&settings.API, "api", false, "Also generate a JSON API in the 'api' folder of the output: paged posts.json lists, posts/<slug>.json with each post's content, and tags.json.")
+	flagSet.IntVar(&settings.APIPageSize, "api-page-size", parse.DefaultAPIPageSize, "Number of posts per page of the API's posts.json lists (used with -api).")
+	flagSet.BoolVar(&settings.Book, "book", false, "Also generate all.html: every article on one page with a table of contents, for printing or saving the blog as a PDF.")
 
 	// --- Dev Server ---
-	watch := flagSet.Bool("watch", false, "Watch mode: Starts a local web server and automatically rebuilds the site when source files change.")
 	flagSet.StringVar(&settings.Port, "port", "666", "The port to use for the local preview server (used with -watch).")
 
+	return sf
+}
+
+// apply validates the processed flag values and completes settings with them and with
+// the values derived from other settings (absolute base URL, author, highlight theme...).
+func (sf *siteFlags) apply(settings *parse.Settings) error {
+	settings.ShareButtons = sf.shareButtons
+	settings.DirectoryPermalinks = sf.directoryPermalinks
+	if settings.Permalink != "" {
+		if err := parse.ValidatePermalink(settings.Permalink); err != nil {
+			return fmt.Errorf("invalid permalink: %v", err)
+		}
+	}
+
+	var buf strings.Builder
+	if err := parse.MarkdownFor(*settings).Convert([]byte(settings.DescriptionMarkdown), &buf); err != nil {
+		return fmt.Errorf("failed to convert description to HTML: %v", err)
+	}
+	settings.DescriptionHTML = template.HTML(buf.String())
+	settings.DescriptionNeedsMathJax = parse.NeedsMathJax(buf.String())
+
+	if *sf.elementsTop != "" {
+		content, err := os.ReadFile(*sf.elementsTop)
+		if err != nil {
+			return fmt.Errorf("error reading additional top elements file: %v", err)
+		}
+		settings.AdditionalElementsTop = template.HTML(content)
+	}
+
+	if *sf.elementsBottom != "" {
+		content, err := os.ReadFile(*sf.elementsBottom)
+		if err != nil {
+			return fmt.Errorf("error reading additional bottom elements file: %v", err)
+		}
+		settings.AdditionalElementsBottom = template.HTML(content)
+	}
+
+	// BaseUrl always ends with the base path, so absolute URLs built from it are correct
+	// both in production and on the local server, which serves the site under the same prefix.
+	settings.BasePath = parse.NormalizeBasePath(settings.BasePath)
+	if settings.BaseUrl == "" {
+		settings.BaseUrl = fmt.Sprintf("http://localhost:%s%s", settings.Port, settings.BasePath)
+	} else {
+		settings.BaseUrl = strings.TrimSuffix(settings.BaseUrl, "/")
+		baseUrl, err := url.Parse(settings.BaseUrl)
+		if err != nil {
+			return fmt.Errorf("invalid base URL '%s': %v", settings.BaseUrl, err)
+		}
+		urlPath := parse.NormalizeBasePath(baseUrl.Path)
+		switch {
+		case settings.BasePath == "":
+			settings.BasePath = urlPath
+		case urlPath == "":
+			settings.BaseUrl += settings.BasePath
+		case urlPath != settings.BasePath:
+			return fmt.Errorf("base path '%s' does not match the path of the base URL '%s'", settings.BasePath, settings.BaseUrl)
+		}
+	}
+
+	// The capsule is expected on the same host as the website.
+	if settings.GeminiUrl == "" {
+		if baseUrl, err := url.Parse(settings.BaseUrl); err == nil {
+			settings.GeminiUrl = "gemini://" + baseUrl.Hostname()
+		}
+	}
+	settings.GeminiUrl = strings.TrimSuffix(settings.GeminiUrl, "/")
+
+	// Default author / publisher names to blog title if not provided.
+	if settings.AuthorName == "" {
+		settings.AuthorName = settings.Title
+	}
+	if settings.PublisherName == "" {
+		settings.PublisherName = settings.Title
+	}
+
+	// Determine syntax highlight style automatically from CSS.
+	settings.HighlightTheme = parse.HighlightStyleForThemeType(parse.GetThemeType(assets, settings.Theme))
+
+	// Parse sort order into strongly-typed SortOrder.
+	sortOrder, err := parse.ParseSortOrder(*sf.sort)
+	if err != nil {
+		return fmt.Errorf("invalid sort order '%s': %v", *sf.sort, err)
+	}
+	settings.Sort = sortOrder
+
+	cspMode, err := parse.ParseCSPMode(*sf.csp)
+	if err != nil {
+		return fmt.Errorf("invalid CSP mode '%s': %v", *sf.csp, err)
+	}
+	settings.CSPMode = cspMode
+
+	if settings.APIPageSize < 1 {
+		return fmt.Errorf("invalid API page size %d: must be at least 1", settings.APIPageSize)
+	}
+	if settings.Offline {
+		if err := parse.CheckVendorLibraries(assets); err != nil {
+			return err
+		}
+	}
+	if settings.RelatedCount < 0 {
+		return fmt.Errorf("invalid related post count %d: must be at least 0", settings.RelatedCount)
+	}
+
+	hostingTargets, err := parse.ParseHostingTargets(*sf.hosting)
+	if err != nil {
+		return fmt.Errorf("invalid hosting targets '%s': %v", *sf.hosting, err)
+	}
+	settings.HostingTargets = hostingTargets
+	return nil
+}
+
+// main is the entrypoint for DSBG (Dead Simple Blog Generator).
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		runExport(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
+
+	flagSet := flag.NewFlagSet("dsbg", flag.ExitOnError)
+
+	var settings parse.Settings
+	sf := defineSiteFlags(flagSet, &settings)
+	watch := flagSet.Bool("watch", false, "Watch mode: Starts a local web server and automatically rebuilds the site when source files change.")
+
 	// --- Custom Usage Output ---
 	flagSet.Usage = func() {
 		fmt.Fprintln(os.Stderr)
@@ -160,6 +346,9 @@ func main() {
 
 		fmt.Fprintf(os.Stderr, "%sUSAGE:%s\n", cBold+cYellow, cReset)
 		fmt.Fprintln(os.Stderr, "  dsbg [flags]")
+		fmt.Fprintln(os.Stderr, "  dsbg export -single-file [flags] [article]   (see 'dsbg export -h')")
+		fmt.Fprintln(os.Stderr, "  dsbg export epub [flags] [article]           (see 'dsbg export -h')")
+		fmt.Fprintln(os.Stderr, "  dsbg import <platform> [flags] <path>        (see 'dsbg import -h')")
 		fmt.Fprintln(os.Stderr)
 
 		// Helper to print a group of flags
@@ -171,11 +360,15 @@ func main() {
 			fmt.Fprintln(os.Stderr)
 		}
 
-		printGroup("GENERAL CONFIGURATION", "input", "output", "title", "description", "base-url", "lang", "overwrite", "ignore-errors")
+		printGroup("GENERAL CONFIGURATION", "input", "output", "title", "description", "base-url", "base-path", "lang", "overwrite", "ignore-errors", "offline")
+		printGroup("SECURITY", "sri", "csp")
+		printGroup("OUTPUT OPTIMIZATION", "minify", "precompress", "precompress-min-size")
+		printGroup("DEPLOYMENT", "hosting", "redirects", "portable")
 		printGroup("METADATA & SEO", "author", "publisher", "logo", "date-format")
 		printGroup("THEMING & UI", "theme", "css-path", "js-path", "favicon-path", "share")
 		printGroup("INJECTIONS", "elements-top", "elements-bottom")
-		printGroup("CONTENT BEHAVIOR", "sort", "ignore-tags-from-paths", "keep-date-in-paths", "keep-date-in-titles", "open-in-new-tab", "index-name")
+		printGroup("CONTENT BEHAVIOR", "sort", "ignore-tags-from-paths", "keep-date-in-paths", "keep-date-in-titles", "permalink", "permalink-dir", "open-in-new-tab", "index-name", "mathml", "obsidian", "related")
+		printGroup("EXTRA OUTPUTS", "markdown", "api", "api-page-size", "book", "gemini", "gemini-url")
 		printGroup("LOCAL DEVELOPMENT", "watch", "port")
 
 		fmt.Fprintf(os.Stderr, "%sFRONTMATTER METADATA:%s\n", cBold+cYellow, cReset)
@@ -187,6 +380,10 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  %-15s %s\n", "cover_image", "Path to an image (relative) for index/social cards.")
 		fmt.Fprintf(os.Stderr, "  %-15s %s\n", "link", "External URL for link-blogging (redirects title link).")
 		fmt.Fprintf(os.Stderr, "  %-15s %s\n", "canonical_url", "Override the canonical URL for SEO/cross-posting.")
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", "aliases", "Former paths (e.g. [/old/post/]) that redirect to the article.")
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", "series", "Name of a series the article is a part of, with a landing page.")
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", "series_order", "Position in the series (1, 2...). Defaults to the creation date.")
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", "related", "Articles listed first as related posts (e.g. [other-post.md, Some Title]).")
 		fmt.Fprintln(os.Stderr)
 
 		fmt.Fprintf(os.Stderr, "%sSHARE TEMPLATE VARIABLES:%s\n", cBold+cYellow, cReset)
@@ -249,14 +446,6 @@ func main() {
 		log.Println("  Use '-base-url https://yourdomain.com' to fix this.")
 	}
 
-	settings.ShareButtons = shareButtons
-
-	var buf strings.Builder
-	if err := parse.Markdown.Convert([]byte(settings.DescriptionMarkdown), &buf); err != nil {
-		log.Fatalf("failed to convert description to HTML: %v", err)
-	}
-	settings.DescriptionHTML = template.HTML(buf.String())
-
 	if _, err := os.Stat(settings.InputPath); os.IsNotExist(err) {
 		if noFlagsPassed(flagSet) {
 			flagSet.Usage()
@@ -265,50 +454,9 @@ func main() {
 		log.Fatalf("Input directory '%s' does not exist.", settings.InputPath)
 	}
 
-	if *pathToAdditionalElementsTop != "" {
-		content, err := os.ReadFile(*pathToAdditionalElementsTop)
-		if err != nil {
-			log.Fatalf("Error reading additional top elements file: %v", err)
-		}
-		settings.AdditionalElementsTop = template.HTML(content)
-	}
-
-	if *pathToAdditionalElementsBottom != "" {
-		content, err := os.ReadFile(*pathToAdditionalElementsBottom)
-		if err != nil {
-			log.Fatalf("Error reading additional bottom elements file: %v", err)
-		}
-		settings.AdditionalElementsBottom = template.HTML(content)
-	}
-
-	if settings.BaseUrl == "" {
-		settings.BaseUrl = fmt.Sprintf("http://localhost:%s", settings.Port)
-	} else {
-		settings.BaseUrl = strings.TrimSuffix(settings.BaseUrl, "/")
-	}
-
-	// Default author / publisher names to blog title if not provided.
-	if settings.AuthorName == "" {
-		settings.AuthorName = settings.Title
-	}
-	if settings.PublisherName == "" {
-		settings.PublisherName = settings.Title
-	}
-
-	// Determine syntax highlight theme automatically from CSS.
-	themeType := parse.GetThemeType(assets, settings.Theme)
-	if themeType == "light" {
-		settings.HighlightTheme = "stackoverflow-light"
-	} else {
-		settings.HighlightTheme = "github-dark-dimmed"
-	}
-
-	// Parse sort order into strongly-typed SortOrder.
-	sortOrder, err := parse.ParseSortOrder(*sortFlag)
-	if err != nil {
-		log.Fatalf("invalid sort order '%s': %v", *sortFlag, err)
+	if err := sf.apply(&settings); err != nil {
+		log.Fatal(err)
 	}
-	settings.Sort = sortOrder
 
 	// Parse templates once.
 	templates, err := parse.LoadTemplates(assets)
@@ -329,7 +477,7 @@ func main() {
 
 		// In watch mode, start the server and open the browser ONCE here.
 		addr := ":" + settings.Port
-		url := fmt.Sprintf("http://localhost%s", addr)
+		url := fmt.Sprintf("http://localhost%s%s/", addr, settings.BasePath)
 
 		go serve(settings)
 
@@ -405,9 +553,6 @@ func startWatcher(settings *parse.Settings, templates parse.SiteTemplates) {
 				}
 
 				log.Println("File change detected:", event.Name, "- Rebuilding website...")
-				// Update build version on rebuild so cache busts instantly
-				settings.BuildVersion = fmt.Sprintf("%d", time.Now().Unix())
-
 				// Perform a clean build to remove orphans from deletions
 				if err := buildWebsite(settings, templates, true); err != nil {
 					log.Printf("Rebuild failed: %v\n", err)
@@ -444,14 +589,83 @@ func openBrowser(url string) error {
 // serve starts an HTTP file server for the generated output directory.
 func serve(settings parse.Settings) {
 	addr := ":" + settings.Port
-	url := fmt.Sprintf("http://localhost%s", addr)
+	url := fmt.Sprintf("http://localhost%s%s/", addr, settings.BasePath)
 	fmt.Printf("Serving website from '%s' at %s. Press Ctrl+C to stop.\n", settings.OutputPath, url)
-	http.Handle("/", http.FileServer(http.Dir(settings.OutputPath)))
+	if settings.BasePath == "" {
+		http.Handle("/", precompressedFileServer(settings.OutputPath))
+	} else {
+		// Serve under the same prefix as production so root-relative links behave identically.
+		http.Handle(settings.BasePath+"/", http.StripPrefix(settings.BasePath, precompressedFileServer(settings.OutputPath)))
+		http.Handle("/", http.RedirectHandler(settings.BasePath+"/", http.StatusFound))
+	}
 	if err := http.ListenAndServe(addr, nil); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
 
+// precompressedFileServer serves files from root like http.FileServer, but answers with a
+// precompressed sibling (e.g. "index.html.br") and the matching Content-Encoding when one
+// exists and the client accepts it.
+func precompressedFileServer(root string) http.Handler {
+	fileServer := http.FileServer(http.Dir(root))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		name := path.Clean("/" + r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			name = path.Join(name, "index.html")
+		}
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			for _, encoding := range parse.PrecompressedEncodings {
+				if !acceptsEncoding(r.Header.Get("Accept-Encoding"), encoding.Name) {
+					continue
+				}
+				f, err := os.Open(filepath.Join(root, filepath.FromSlash(name+encoding.Extension)))
+				if err != nil {
+					continue
+				}
+				info, err := f.Stat()
+				if err != nil || info.IsDir() {
+					f.Close()
+					continue
+				}
+				w.Header().Set("Content-Encoding", encoding.Name)
+				// ServeContent derives the Content-Type from the original name.
+				http.ServeContent(w, r, name, info.ModTime(), f)
+				f.Close()
+				return
+			}
+		}
+		// Mirror static hosts by answering unknown paths with the custom 404 page.
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); os.IsNotExist(err) {
+			if notFound, err := os.ReadFile(filepath.Join(root, parse.NotFoundPageName)); err == nil {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(http.StatusNotFound)
+				w.Write(notFound)
+				return
+			}
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows the given coding.
+func acceptsEncoding(header string, coding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(token), coding) {
+			continue
+		}
+		// A zero quality value explicitly refuses the coding.
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(value, 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 // deleteChildren removes all children of a directory but keeps the directory itself.
 func deleteChildren(dir string) error {
 	d, err := os.Open(dir)
@@ -505,8 +719,11 @@ func buildWebsite(settings *parse.Settings, templates parse.SiteTemplates, clean
 		return fmt.Errorf("error creating output directory: %v", err)
 	}
 
+	// Fingerprinted asset names are collected while assets are written.
+	settings.AssetManifest = map[string]string{}
+
 	// Handle share assets.
-	for i, btn := range settings.ShareButtons {
+	for _, btn := range settings.ShareButtons {
 		if strings.HasPrefix(btn.Display, "http://") || strings.HasPrefix(btn.Display, "https://") {
 			continue
 		}
@@ -519,8 +736,13 @@ func buildWebsite(settings *parse.Settings, templates parse.SiteTemplates, clean
 					return fmt.Errorf("failed to copy share icon '%s': %w", src, err)
 				}
 				log.Printf("Warning: Failed to copy share icon '%s': %v", src, err)
+				continue
+			}
+			fingerprinted, err := parse.FingerprintAsset(settings.OutputPath, destName, false)
+			if err != nil {
+				return err
 			}
-			settings.ShareButtons[i].Display = destName
+			settings.AssetManifest[destName] = fingerprinted
 		}
 	}
 
@@ -543,96 +765,238 @@ func buildWebsite(settings *parse.Settings, templates parse.SiteTemplates, clean
 		}
 	}
 
+	var minifyStats parse.MinifyStats
+
+	// Shared assets are written first so their integrity values are known when pages are rendered.
+	if err := saveStaticAssets(settings, &minifyStats); err != nil {
+		return err
+	}
+
 	files, err := parse.GetPaths(settings.InputPath, []string{".md", ".html"})
 	if err != nil {
 		return fmt.Errorf("error getting content files: %v", err)
 	}
 
+	// Links between files, like Obsidian's [[wikilinks]], are resolved through the vault.
+	settings.Vault = nil
+	if settings.Obsidian {
+		if settings.Vault, err = parse.NewVault(*settings); err != nil {
+			return fmt.Errorf("error indexing content files: %v", err)
+		}
+	}
+
+	// Files are read first, so every article knows which others link to it when its
+	// page is written.
 	var articles []parse.Article
-	var searchIndex []map[string]interface{}
+	var notFound []parse.Article
 	var mu sync.Mutex
+	forEachConcurrently(len(files), func(i int) {
+		filePath := files[i]
+		article, err := readFile(filePath, *settings)
+		if err != nil {
+			// Handle error based on IgnoreErrors setting
+			if !settings.IgnoreErrors {
+				log.Fatalf("Error processing file %s: %v", filePath, err)
+			}
+			log.Printf("Warning: Skipping file %s due to error: %v\n", filePath, err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		// The 404 page is written but not listed, searched, linked or syndicated.
+		if article.LinkToSelf == parse.NotFoundPageName {
+			notFound = append(notFound, article)
+		} else {
+			articles = append(articles, article)
+		}
+	})
 
-	// Worker pool for concurrent processing of files.
-	numWorkers := runtime.NumCPU()
-	if numWorkers < 1 {
-		numWorkers = 1
+	if err := parse.CheckPageCollisions(append(notFound, articles...)); err != nil {
+		if !settings.IgnoreErrors {
+			return fmt.Errorf("error resolving page paths: %v", err)
+		}
+		log.Printf("Warning: %v\n", err)
 	}
 
-	pathsCh := make(chan string)
-	var wg sync.WaitGroup
-
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for filePath := range pathsCh {
-				article, err := processFile(filePath, *settings, templates)
-				if err != nil {
-					// Handle error based on IgnoreErrors setting
-					if !settings.IgnoreErrors {
-						log.Fatalf("Error processing file %s: %v", filePath, err)
-					}
-					log.Printf("Warning: Skipping file %s due to error: %v\n", filePath, err)
-					continue
-				}
-
-				mu.Lock()
-				articles = append(articles, article)
-
-				searchIndex = append(searchIndex, map[string]interface{}{
-					"title":       article.Title,
-					"content":     article.TextContent,
-					"description": article.Description,
-					"tags":        article.Tags,
-					"url":         article.LinkToSelf,
-				})
-				mu.Unlock()
+	parse.SortArticles(articles, settings.Sort)
+	parse.LinkArticles(articles, *settings)
+	parse.RelateArticles(articles, *settings)
+	series := parse.GroupSeries(articles, *settings)
+	parse.LinkNeighbors(articles, settings.Sort)
+	parse.SetBreadcrumbs(articles, *settings)
+
+	// Pages are written in place, so articles keep their order.
+	pages := append(notFound, articles...)
+	written := make([]bool, len(pages))
+	forEachConcurrently(len(pages), func(i int) {
+		page, err := writeArticle(pages[i], *settings, templates)
+		if err != nil {
+			if !settings.IgnoreErrors {
+				log.Fatalf("Error processing file %s: %v", pages[i].OriginalPath, err)
 			}
-		}()
-	}
-
-	for _, path := range files {
-		pathsCh <- path
+			log.Printf("Warning: Skipping file %s due to error: %v\n", pages[i].OriginalPath, err)
+			return
+		}
+		pages[i], written[i] = page, true
+	})
+	articles = nil
+	for i, page := range pages {
+		if written[i] && page.LinkToSelf != parse.NotFoundPageName {
+			articles = append(articles, page)
+		}
 	}
-	close(pathsCh)
-	wg.Wait()
 
-	switch settings.Sort {
-	case parse.SortDateCreated:
-		sort.Slice(articles, func(i, j int) bool { return articles[i].Created.After(articles[j].Created) })
-	case parse.SortReverseDateCreated:
-		sort.Slice(articles, func(i, j int) bool { return articles[i].Created.Before(articles[j].Created) })
-	case parse.SortDateUpdated:
-		sort.Slice(articles, func(i, j int) bool { return articles[i].Updated.After(articles[j].Updated) })
-	case parse.SortReverseDateUpdated:
-		sort.Slice(articles, func(i, j int) bool { return articles[i].Updated.Before(articles[j].Updated) })
-	case parse.SortTitle:
-		sort.Slice(articles, func(i, j int) bool { return articles[i].Title < articles[j].Title })
-	case parse.SortReverseTitle:
-		sort.Slice(articles, func(i, j int) bool { return articles[i].Title > articles[j].Title })
-	case parse.SortPath:
-		sort.Slice(articles, func(i, j int) bool { return articles[i].OriginalPath < articles[j].OriginalPath })
-	case parse.SortReversePath:
-		sort.Slice(articles, func(i, j int) bool { return articles[i].OriginalPath > articles[j].OriginalPath })
+	var searchIndex []map[string]interface{}
+	for _, article := range articles {
+		searchIndex = append(searchIndex, map[string]interface{}{
+			"title":       article.Title,
+			"content":     article.TextContent,
+			"description": article.Description,
+			"tags":        article.Tags,
+			"url":         article.LinkToSelf,
+		})
 	}
 
 	searchIndexJSON, err := json.Marshal(searchIndex)
 	if err != nil {
 		return fmt.Errorf("error marshaling search index to JSON: %v", err)
 	}
-	searchIndexPath := filepath.Join(settings.OutputPath, "search_index.json")
-	if err := os.WriteFile(searchIndexPath, searchIndexJSON, 0644); err != nil {
-		return fmt.Errorf("error saving search index JSON file: %v", err)
+	if settings.Portable {
+		// Browsers block fetch() on file:// URLs, so the index is loaded through a <script> tag instead.
+		searchIndexScript := append([]byte("window.DSBG_SEARCH_INDEX = "), searchIndexJSON...)
+		searchIndexScript = append(searchIndexScript, ";\n"...)
+		if err := os.WriteFile(filepath.Join(settings.OutputPath, "search_index.js"), searchIndexScript, 0644); err != nil {
+			return fmt.Errorf("error saving search index script: %v", err)
+		}
+	} else {
+		searchIndexPath := filepath.Join(settings.OutputPath, "search_index.json")
+		if err := os.WriteFile(searchIndexPath, searchIndexJSON, 0644); err != nil {
+			return fmt.Errorf("error saving search index JSON file: %v", err)
+		}
+	}
+
+	if err := parse.GenerateGraph(articles, *settings); err != nil {
+		return fmt.Errorf("error generating site graph: %v", err)
+	}
+
+	if err := parse.GenerateSeriesPages(series, *settings, templates.Series); err != nil {
+		return fmt.Errorf("error generating series pages: %v", err)
 	}
 
 	if err := parse.GenerateHtmlIndex(articles, *settings, templates.Index, assets); err != nil {
 		return fmt.Errorf("error generating HTML index page: %v", err)
 	}
 
+	if settings.Book {
+		if err := parse.GenerateBook(articles, *settings, templates.Book); err != nil {
+			return fmt.Errorf("error generating book page: %v", err)
+		}
+	}
+
+	if settings.Markdown {
+		if err := parse.GenerateMarkdownMirrors(articles, *settings); err != nil {
+			return fmt.Errorf("error generating Markdown mirrors: %v", err)
+		}
+	}
+
+	if settings.API {
+		if err := parse.GenerateAPI(articles, *settings); err != nil {
+			return fmt.Errorf("error generating JSON API: %v", err)
+		}
+	}
+
+	if settings.Gemini {
+		if err := parse.GenerateGemini(articles, *settings, templates.Gemini); err != nil {
+			return fmt.Errorf("error generating Gemini capsule: %v", err)
+		}
+	}
+
 	if err := parse.GenerateRSS(articles, *settings, templates.RSS, assets); err != nil {
 		return fmt.Errorf("error generating RSS feed: %v", err)
 	}
 
+	if settings.Offline {
+		if err := parse.SaveVendorLibrary(assets, "lunr", settings.OutputPath); err != nil {
+			return fmt.Errorf("error saving search library: %v", err)
+		}
+		needsMathJax := settings.DescriptionNeedsMathJax
+		for _, article := range articles {
+			needsMathJax = needsMathJax || article.NeedsMathJax
+		}
+		if needsMathJax {
+			if err := parse.SaveVendorLibrary(assets, "mathjax", settings.OutputPath); err != nil {
+				return fmt.Errorf("error saving MathJax library: %v", err)
+			}
+		}
+	}
+	// Redirects from aliases and the CSV file are listed in the hosting configuration files,
+	// and get meta refresh pages for hosts without redirect rules.
+	redirects := parse.ArticleRedirects(articles, *settings)
+	if settings.RedirectsCSVPath != "" {
+		csvRedirects, err := parse.LoadRedirectsCSV(settings.RedirectsCSVPath)
+		if err != nil {
+			return fmt.Errorf("error loading redirects: %v", err)
+		}
+		redirects = append(redirects, csvRedirects...)
+	}
+	if settings.NeedsRedirectPages() {
+		if err := parse.WriteRedirectPages(redirects, *settings); err != nil {
+			return fmt.Errorf("error writing redirect pages: %v", err)
+		}
+	}
+
+	if settings.Minify {
+		// Fingerprinted assets were minified before hashing; minifying them again would break their names.
+		skip := map[string]bool{}
+		for _, name := range settings.AssetManifest {
+			skip[name] = true
+		}
+		if err := parse.MinifyOutput(settings.OutputPath, skip, settings.IgnoreErrors, &minifyStats); err != nil {
+			return fmt.Errorf("error minifying output: %v", err)
+		}
+		log.Println(minifyStats.Summary())
+	}
+	if settings.CSPInHeaders() || len(settings.HostingTargets) > 0 {
+		var policy parse.CSP
+		if settings.CSPInHeaders() {
+			policy, err = parse.SiteCSP(settings.OutputPath)
+			if err != nil {
+				return fmt.Errorf("error computing Content-Security-Policy: %v", err)
+			}
+		}
+		config, err := parse.NewHostingConfig(*settings, redirects, policy)
+		if err != nil {
+			return fmt.Errorf("error describing hosting configuration: %v", err)
+		}
+		// "-csp headers" alone still produces a _headers file.
+		if len(settings.HostingTargets) == 0 {
+			if err := parse.SaveHeadersFile(config, settings.OutputPath); err != nil {
+				return err
+			}
+		}
+		if err := parse.SaveHostingFiles(config, settings.HostingTargets, settings.OutputPath); err != nil {
+			return err
+		}
+	}
+
+	// Compression runs last so every file written above gets its siblings.
+	if settings.Precompress {
+		count, err := parse.PrecompressOutput(settings.OutputPath, settings.PrecompressMinSize)
+		if err != nil {
+			return fmt.Errorf("error precompressing output: %v", err)
+		}
+		log.Printf("Precompressed %d files (.br, .gz)", count)
+	}
+
+	log.Println("Website generated successfully in:", settings.OutputPath)
+	return nil
+}
+
+// saveStaticAssets writes the stylesheets, scripts and icons shared by all pages under
+// fingerprinted names and records them in the asset manifest. When SRI is enabled,
+// it also records their integrity values for the templates. When minification is
+// enabled, stylesheets and scripts are minified first, with the savings added to stats.
+func saveStaticAssets(settings *parse.Settings, stats *parse.MinifyStats) error {
 	if settings.PathToCustomCss == "" {
 		if err := parse.SaveThemeCSS(assets, settings.Theme, settings.OutputPath, settings.IgnoreErrors); err != nil {
 			return fmt.Errorf("error processing theme CSS: %v", err)
@@ -643,6 +1007,10 @@ func buildWebsite(settings *parse.Settings, templates parse.SiteTemplates, clean
 		}
 	}
 
+	if err := parse.SaveHighlightCSS(settings.HighlightTheme, settings.OutputPath); err != nil {
+		return fmt.Errorf("error generating syntax highlighting CSS: %v", err)
+	}
+
 	if settings.PathToCustomJs == "" {
 		saveAsset("script.js", "script.js", settings.OutputPath)
 	} else {
@@ -663,12 +1031,76 @@ func buildWebsite(settings *parse.Settings, templates parse.SiteTemplates, clean
 	saveAsset("rss.svg", "rss.svg", settings.OutputPath)
 	saveAsset("copy.svg", "copy.svg", settings.OutputPath)
 
-	log.Println("Website generated successfully in:", settings.OutputPath)
+	if settings.Minify {
+		for _, name := range []string{"style.css", parse.HighlightStylesheetName, "script.js", "search.js"} {
+			if err := parse.MinifyFile(filepath.Join(settings.OutputPath, name), stats); err != nil {
+				if !settings.IgnoreErrors {
+					return fmt.Errorf("error minifying '%s': %v", name, err)
+				}
+				log.Printf("Warning: Keeping '%s' unminified: %v", name, err)
+			}
+		}
+	}
+
+	if settings.SRI {
+		settings.Integrity = map[string]string{}
+		for _, name := range []string{"style.css", parse.HighlightStylesheetName, "script.js", "search.js"} {
+			content, err := os.ReadFile(filepath.Join(settings.OutputPath, name))
+			if err != nil {
+				return fmt.Errorf("error reading '%s' to compute its integrity: %v", name, err)
+			}
+			settings.Integrity[name] = parse.ComputeIntegrity(content)
+		}
+		for _, lib := range parse.VendorLibraries {
+			integrity, err := parse.VendorIntegrity(assets, lib.Name)
+			if err != nil {
+				// Without -offline, checked by siteFlags.apply, the CDN copy is used without integrity.
+				log.Printf("Warning: No integrity value for '%s': %v\n", lib.Name, err)
+				continue
+			}
+			settings.Integrity[path.Join(parse.VendorOutputDir, lib.File)] = integrity
+		}
+	}
+
+	// Content-hashed names let browsers and CDNs cache assets until they actually change.
+	for _, name := range []string{"style.css", parse.HighlightStylesheetName, "script.js", "search.js", "favicon.ico", "rss.svg", "copy.svg"} {
+		fingerprinted, err := parse.FingerprintAsset(settings.OutputPath, name, name == "favicon.ico")
+		if err != nil {
+			return err
+		}
+		settings.AssetManifest[name] = fingerprinted
+	}
+	if err := parse.SaveAssetManifest(settings.AssetManifest, settings.OutputPath); err != nil {
+		return err
+	}
 	return nil
 }
 
-// processFile parses a single Markdown or HTML file into an Article and writes its output HTML.
-func processFile(filePath string, settings parse.Settings, templates parse.SiteTemplates) (parse.Article, error) {
+// forEachConcurrently calls work for every index from 0 to n-1, on as many goroutines
+// as there are CPUs.
+func forEachConcurrently(n int, work func(i int)) {
+	numWorkers := max(runtime.NumCPU(), 1)
+	indexesCh := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexesCh {
+				work(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexesCh <- i
+	}
+	close(indexesCh)
+	wg.Wait()
+}
+
+// readFile parses a Markdown or HTML file into an Article and copies the resources it
+// references to the output directory.
+func readFile(filePath string, settings parse.Settings) (parse.Article, error) {
 	var article parse.Article
 	var resources []string
 	var err error
@@ -679,23 +1111,35 @@ func processFile(filePath string, settings parse.Settings, templates parse.SiteT
 		if err != nil {
 			return parse.Article{}, fmt.Errorf("error parsing markdown file: %w", err)
 		}
-		if err := parse.CopyHtmlResources(settings, &article, resources); err != nil {
-			return parse.Article{}, fmt.Errorf("error copying resources: %w", err)
-		}
-		if err := parse.FormatMarkdown(&article, settings, templates.Article, assets); err != nil {
-			return parse.Article{}, fmt.Errorf("error formatting markdown: %w", err)
-		}
 	} else if strings.HasSuffix(filePathLower, ".html") {
 		article, resources, err = parse.HTMLFile(filePath, settings)
 		if err != nil {
 			return parse.Article{}, fmt.Errorf("error parsing HTML file: %w", err)
 		}
-		if err := parse.CopyHtmlResources(settings, &article, resources); err != nil {
-			return parse.Article{}, fmt.Errorf("error copying resources: %w", err)
-		}
 	} else {
 		return parse.Article{}, fmt.Errorf("unsupported file type: %s", filePath)
 	}
+	if err := parse.CopyHtmlResources(settings, &article, resources); err != nil {
+		return parse.Article{}, fmt.Errorf("error copying resources: %w", err)
+	}
+	return article, nil
+}
+
+// writeArticle writes the page of an article read by readFile: Markdown articles are
+// rendered with the article template, HTML articles are written as they are.
+func writeArticle(article parse.Article, settings parse.Settings, templates parse.SiteTemplates) (parse.Article, error) {
+	isMarkdown := strings.HasSuffix(strings.ToLower(article.OriginalPath), ".md")
+	if isMarkdown {
+		if err := parse.FormatMarkdown(&article, settings, templates.Article, assets); err != nil {
+			return parse.Article{}, fmt.Errorf("error formatting markdown: %w", err)
+		}
+	}
+	if article.LinkToSelf == parse.NotFoundPageName && !settings.Portable {
+		article.HtmlContent = parse.InjectBaseHref(article.HtmlContent, settings.BaseUrl)
+	}
+	if isMarkdown && settings.CSPInMeta() {
+		article.HtmlContent = parse.InjectCSPMeta(article.HtmlContent, parse.PageCSP(article.HtmlContent))
+	}
 
 	if err := os.WriteFile(article.LinkToSave, []byte(article.HtmlContent), 0644); err != nil {
 		return parse.Article{}, fmt.Errorf("error writing processed file: %w", err)
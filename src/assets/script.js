@@ -1,3 +1,17 @@
+/**
+ * Handles clicks on "Copy Markdown" buttons (elements with the copy-markdown class).
+ * Event delegation keeps the markup free of inline handlers, which a
+ * Content-Security-Policy would block.
+ */
+document.addEventListener("click", function (e) {
+    const element = e.target.closest(".copy-markdown");
+    if (!element) {
+        return;
+    }
+    e.preventDefault();
+    copyMarkdownToClipboard(element);
+});
+
 /**
  * Initializes tag filters by:
  * 1. Extracting unique tags from all button elements within the document.
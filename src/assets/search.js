@@ -5,13 +5,24 @@ document.addEventListener('DOMContentLoaded', function () {
     let lunrIndex;
     let articleMap = {};
     const minSearchChars = 3; // Minimum characters to trigger a search
+    // Subpath the site is served under (e.g. "/blog"), set by the -base-path flag.
+    // When empty, URLs stay relative to the index page.
+    const basePath = document.documentElement.dataset.basePath || '';
+    const siteUrl = (path) => basePath ? `${basePath}/${path}` : path;
+
+    // Load the index data. Portable builds embed it in search_index.js,
+    // because fetch() is blocked for file:// URLs.
+    async function loadArticleData() {
+        if (window.DSBG_SEARCH_INDEX) return window.DSBG_SEARCH_INDEX;
+        const response = await fetch(siteUrl('search_index.json'));
+        if (!response.ok) throw new Error('Network response was not ok.');
+        return response.json();
+    }
 
-    // Initialize search by fetching the index
+    // Initialize search by loading the index
     async function initializeSearch() {
         try {
-            const response = await fetch('search_index.json');
-            if (!response.ok) throw new Error('Network response was not ok.');
-            const articleData = await response.json();
+            const articleData = await loadArticleData();
 
             // Map articles by URL (which serves as the ID/Ref)
             articleData.forEach(article => {
@@ -104,7 +115,7 @@ document.addEventListener('DOMContentLoaded', function () {
                     // Use content (plain text) for snippet generation
                     const snippet = createSnippet(article.content, term);
                     // Use article.url (the ref) for the link
-                    return `<li><a href="${article.url}">${article.title}</a><div class="search-result-snippet">${snippet}</div></li>`;
+                    return `<li><a href="${siteUrl(article.url)}">${article.title}</a><div class="search-result-snippet">${snippet}</div></li>`;
                 }).join('');
             }
         } catch (e) {
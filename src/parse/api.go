@@ -0,0 +1,195 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// APIDirName is the folder of the output directory holding the JSON API written with -api.
+const APIDirName = "api"
+
+// DefaultAPIPageSize is the default number of posts per page of posts.json.
+const DefaultAPIPageSize = 20
+
+// apiPostSummary describes a post in the paged post lists.
+type apiPostSummary struct {
+	Slug         string    `json:"slug"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	Created      time.Time `json:"created"`
+	Updated      time.Time `json:"updated"`
+	Tags         []string  `json:"tags"`
+	URL          string    `json:"url"`
+	JSON         string    `json:"json"`
+	CoverImage   string    `json:"cover_image,omitempty"`
+	ExternalLink string    `json:"external_link,omitempty"`
+}
+
+// apiPost is the content of posts/<slug>.json.
+type apiPost struct {
+	apiPostSummary
+	CanonicalURL string `json:"canonical_url,omitempty"`
+	Content      string `json:"content"` // BodyContent, with absolute links and resources
+	Text         string `json:"text"`
+}
+
+// apiPage is one page of the post list: posts.json, posts-2.json...
+type apiPage struct {
+	Page       int              `json:"page"`
+	TotalPages int              `json:"total_pages"`
+	TotalPosts int              `json:"total_posts"`
+	Prev       string           `json:"prev,omitempty"`
+	Next       string           `json:"next,omitempty"`
+	Posts      []apiPostSummary `json:"posts"`
+}
+
+// apiTag lists the posts having a tag.
+type apiTag struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Posts []string `json:"posts"` // Slugs
+}
+
+// apiPageName returns the file name of a page of the post list.
+func apiPageName(page int) string {
+	if page == 1 {
+		return "posts.json"
+	}
+	return fmt.Sprintf("posts-%d.json", page)
+}
+
+// absoluteBody returns the BodyContent of article with links to other articles replaced
+// by targets[key] (see ArticleLinkKeys), and other relative links and resources made
+// absolute, for clients that display the content outside the site.
+func absoluteBody(article Article, targets map[string]string, settings Settings) (string, error) {
+	doc, err := html.Parse(strings.NewReader(article.BodyContent))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse content of '%s': %w", article.OriginalPath, err)
+	}
+	rebaseResources(doc, article, settings.BaseUrl+"/")
+	rewriteLinks(doc, article, targets, settings, func(u *url.URL) string {
+		return settings.BaseUrl + u.RequestURI() + fragmentSuffix(u)
+	})
+	return getBodyContent(doc)
+}
+
+// writeJSON marshals v into the file at filePath.
+func writeJSON(filePath string, v any) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error marshaling '%s': %w", filePath, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for '%s': %w", filePath, err)
+	}
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		return fmt.Errorf("error writing '%s': %w", filePath, err)
+	}
+	return nil
+}
+
+// GenerateAPI writes a read-only JSON API into the APIDirName folder of the output
+// directory, for apps reusing the blog's content: the posts (pages excluded) in their
+// given order as paged lists (posts.json, posts-2.json...), each post with its content
+// in posts/<slug>.json, and the tags with their posts in tags.json. Lists hold
+// APIPageSize posts per page, and the slug of a post is its ArticleAnchor, followed by
+// "-2", "-3"... if another post already has it.
+func GenerateAPI(articles []Article, settings Settings) error {
+	pageSize := settings.APIPageSize
+	apiRoot := filepath.Join(settings.OutputPath, APIDirName)
+	apiUrl := settings.BaseUrl + "/" + APIDirName + "/"
+
+	var posts []Article
+	targets := map[string]string{}
+	for _, article := range articles {
+		if slices.Contains(article.Tags, "PAGE") {
+			continue
+		}
+		posts = append(posts, article)
+		for _, key := range ArticleLinkKeys(article, settings) {
+			targets[key] = toAbsoluteUrl(article.LinkToSelf, settings.BaseUrl)
+		}
+	}
+
+	summaries := make([]apiPostSummary, 0, len(posts))
+	tagPosts := map[string][]string{}
+	used := map[string]bool{} // Lowercased, for case-insensitive file systems
+	for _, article := range posts {
+		slug := ArticleAnchor(article, settings)
+		for n := 2; used[strings.ToLower(slug)]; n++ {
+			slug = fmt.Sprintf("%s-%d", ArticleAnchor(article, settings), n)
+		}
+		used[strings.ToLower(slug)] = true
+		summary := apiPostSummary{
+			Slug:         slug,
+			Title:        article.Title,
+			Description:  article.Description,
+			Created:      article.Created,
+			Updated:      article.Updated,
+			Tags:         article.Tags,
+			URL:          toAbsoluteUrl(EncodePathSegments(article.LinkToSelf), settings.BaseUrl),
+			JSON:         apiUrl + EncodePathSegments("posts/"+slug+".json"),
+			CoverImage:   toAbsoluteUrl(article.CoverImage, settings.BaseUrl),
+			ExternalLink: article.ExternalLink,
+		}
+		if summary.Tags == nil {
+			summary.Tags = []string{}
+		}
+		summaries = append(summaries, summary)
+		for _, tag := range article.Tags {
+			if !slices.Contains(tagPosts[tag], slug) {
+				tagPosts[tag] = append(tagPosts[tag], slug)
+			}
+		}
+
+		content, err := absoluteBody(article, targets, settings)
+		if err != nil {
+			return err
+		}
+		err = writeJSON(filepath.Join(apiRoot, "posts", slug+".json"), apiPost{
+			apiPostSummary: summary,
+			CanonicalURL:   article.CanonicalUrl,
+			Content:        content,
+			Text:           article.TextContent,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	totalPages := max(1, (len(summaries)+pageSize-1)/pageSize)
+	for page := 1; page <= totalPages; page++ {
+		list := apiPage{
+			Page:       page,
+			TotalPages: totalPages,
+			TotalPosts: len(summaries),
+			Posts:      summaries[min((page-1)*pageSize, len(summaries)):min(page*pageSize, len(summaries))],
+		}
+		if page > 1 {
+			list.Prev = apiUrl + apiPageName(page-1)
+		}
+		if page < totalPages {
+			list.Next = apiUrl + apiPageName(page+1)
+		}
+		if err := writeJSON(filepath.Join(apiRoot, apiPageName(page)), list); err != nil {
+			return err
+		}
+	}
+
+	tags := make([]apiTag, 0, len(tagPosts))
+	for name, slugs := range tagPosts {
+		tags = append(tags, apiTag{Name: name, Count: len(slugs), Posts: slugs})
+	}
+	slices.SortFunc(tags, func(a, b apiTag) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return writeJSON(filepath.Join(apiRoot, "tags.json"), tags)
+}
@@ -0,0 +1,110 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+
+	"golang.org/x/net/html"
+)
+
+// BookPageName is the file name of the page combining all articles, written with -book.
+const BookPageName = "all.html"
+
+// bookBody returns the BodyContent of article prepared for the book page, which sits at
+// the site root: relative resources are rebased on the article's folder, links to other
+// articles become in-page anchors (see ArticleAnchor), and ids are prefixed with the
+// article's anchor, so headings and footnotes of different articles cannot collide.
+func bookBody(article Article, targets map[string]string, settings Settings) (string, error) {
+	doc, err := html.Parse(strings.NewReader(article.BodyContent))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse content of '%s': %w", article.OriginalPath, err)
+	}
+	anchor := ArticleAnchor(article, settings)
+	rebaseResources(doc, article, "")
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, attr := range n.Attr {
+				switch {
+				case attr.Key == "id":
+					n.Attr[i].Val = anchor + "--" + attr.Val
+				case n.Data == "a" && attr.Key == "href" && strings.HasPrefix(attr.Val, "#") && len(attr.Val) > 1:
+					n.Attr[i].Val = "#" + anchor + "--" + attr.Val[1:]
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	rewriteLinks(doc, article, targets, settings, func(u *url.URL) string {
+		link := strings.TrimPrefix(u.RequestURI(), "/")
+		if link == "" {
+			link = "./"
+		}
+		return link + fragmentSuffix(u)
+	})
+	return getBodyContent(doc)
+}
+
+// GenerateBook writes BookPageName, a page with a table of contents followed by the
+// content of every listed article (pages excluded) in order, styled to print or save as
+// a PDF from the browser with each article starting on a new page.
+func GenerateBook(articles []Article, settings Settings, tmpl *texttemplate.Template) error {
+	var chapters []Article
+	for _, article := range articles {
+		if !slices.Contains(article.Tags, "PAGE") {
+			chapters = append(chapters, article)
+		}
+	}
+
+	targets := map[string]string{}
+	for _, chapter := range chapters {
+		for _, key := range ArticleLinkKeys(chapter, settings) {
+			targets[key] = "#" + ArticleAnchor(chapter, settings)
+		}
+	}
+	needsMathJax := false
+	for i := range chapters {
+		body, err := bookBody(chapters[i], targets, settings)
+		if err != nil {
+			return err
+		}
+		chapters[i].BodyContent = body
+		needsMathJax = needsMathJax || chapters[i].NeedsMathJax
+	}
+
+	var tp bytes.Buffer
+	err := tmpl.Execute(&tp, struct {
+		Articles     []Article
+		Settings     Settings
+		NeedsMathJax bool
+	}{
+		Articles:     chapters,
+		Settings:     settings,
+		NeedsMathJax: needsMathJax,
+	})
+	if err != nil {
+		return fmt.Errorf("error executing book template: %w", err)
+	}
+
+	content := tp.String()
+	if settings.CSPInMeta() {
+		content = InjectCSPMeta(content, PageCSP(content))
+	}
+
+	filePath := filepath.Join(settings.OutputPath, BookPageName)
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing book page to '%s': %w", filePath, err)
+	}
+	return nil
+}
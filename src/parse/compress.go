@@ -0,0 +1,136 @@
+package parse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// DefaultPrecompressMinSize is the smallest file, in bytes, for which compressed
+// siblings are written. Below it the savings do not outweigh the extra request overhead.
+const DefaultPrecompressMinSize = 1024
+
+// Encoding describes a precompressed variant served for a given Content-Encoding.
+type Encoding struct {
+	Name      string // Content-Encoding token, e.g. "br"
+	Extension string // Suffix appended to the original file name, e.g. ".br"
+	compress  func(w io.Writer, content []byte) error
+}
+
+// PrecompressedEncodings lists the variants written next to compressible files,
+// in the order servers should prefer them.
+var PrecompressedEncodings = []Encoding{
+	{Name: "br", Extension: ".br", compress: compressBrotli},
+	{Name: "gzip", Extension: ".gz", compress: compressGzip},
+}
+
+// compressibleExtensions maps the text-based output types worth precompressing to their
+// media types. Images, fonts and videos are already compressed.
+var compressibleExtensions = map[string]string{
+	".html": "text/html", ".htm": "text/html", ".css": "text/css",
+	".js": "application/javascript", ".mjs": "application/javascript", ".json": "application/json",
+	".xml": "application/xml", ".svg": "image/svg+xml", ".txt": "text/plain", ".md": "text/markdown",
+	".map": "application/json", ".webmanifest": "application/manifest+json",
+}
+
+// compressibleExtensionList returns the keys of compressibleExtensions in a stable order.
+func compressibleExtensionList() []string {
+	extensions := make([]string, 0, len(compressibleExtensions))
+	for ext := range compressibleExtensions {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+func compressGzip(w io.Writer, content []byte) error {
+	zw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(content); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func compressBrotli(w io.Writer, content []byte) error {
+	bw := brotli.NewWriterLevel(w, brotli.BestCompression)
+	if _, err := bw.Write(content); err != nil {
+		return err
+	}
+	return bw.Close()
+}
+
+// IsCompressible reports whether a file type benefits from precompression.
+func IsCompressible(fileName string) bool {
+	_, ok := compressibleExtensions[strings.ToLower(filepath.Ext(fileName))]
+	return ok
+}
+
+// PrecompressFile writes a sibling for every encoding in PrecompressedEncodings
+// (e.g. "rss.xml.gz" and "rss.xml.br"). Variants that would not be smaller than the
+// original are skipped. It returns the number of siblings written.
+func PrecompressFile(filePath string) (int, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read '%s' for compression: %w", filePath, err)
+	}
+
+	written := 0
+	for _, encoding := range PrecompressedEncodings {
+		var buf bytes.Buffer
+		if err := encoding.compress(&buf, content); err != nil {
+			return written, fmt.Errorf("failed to compress '%s' with %s: %w", filePath, encoding.Name, err)
+		}
+		destPath := filePath + encoding.Extension
+		if buf.Len() >= len(content) {
+			// Remove a stale variant left by a previous build.
+			os.Remove(destPath)
+			continue
+		}
+		if err := os.WriteFile(destPath, buf.Bytes(), 0644); err != nil {
+			return written, fmt.Errorf("failed to write '%s': %w", destPath, err)
+		}
+		written++
+	}
+	return written, nil
+}
+
+// PrecompressOutput writes compressed siblings for every compressible file in the
+// output directory that is at least minSize bytes. It returns the number of files compressed.
+func PrecompressOutput(outputDirectory string, minSize int) (int, error) {
+	count := 0
+	err := filepath.WalkDir(outputDirectory, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !IsCompressible(p) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() < int64(minSize) {
+			return nil
+		}
+		written, err := PrecompressFile(p)
+		if err != nil {
+			return err
+		}
+		if written > 0 {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
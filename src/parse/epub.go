@@ -0,0 +1,405 @@
+package parse
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// EpubMimeType is the content of the "mimetype" file that must open every EPUB container.
+const EpubMimeType = "application/epub+zip"
+
+// epubContentDir is the folder of the container holding the package document and content.
+const epubContentDir = "OEBPS"
+
+// epubNonInteractiveElements are removed from chapters: e-readers do not run scripts,
+// and forms or embedded frames cannot work without them.
+var epubNonInteractiveElements = []string{"script", "noscript", "iframe", "form", "input", "button", "textarea", "object", "embed"}
+
+// regexUnsafeFileName matches characters replaced in the names of files added to an EPUB.
+var regexUnsafeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// epubItem is a file of an EPUB publication listed in its manifest.
+type epubItem struct {
+	ID         string
+	Href       string // Path relative to the content folder
+	MediaType  string
+	Properties string // Manifest properties, e.g. "cover-image"
+	content    []byte
+}
+
+// epubChapter is an article added to an EPUB publication as an XHTML content document.
+type epubChapter struct {
+	epubItem
+	Title       string
+	Description string
+	Created     time.Time
+	Body        string
+	article     Article
+}
+
+// Epub collects articles and the images and media they embed into an EPUB 3 publication.
+type Epub struct {
+	Title     string
+	settings  Settings
+	chapters  []epubChapter
+	resources []epubItem
+	hrefs     map[string]string // Source path of each resource mapped to its href
+	cover     int               // Index of the cover in resources, or -1
+}
+
+// NewEpub starts an empty publication named title.
+func NewEpub(title string, settings Settings) *Epub {
+	return &Epub{Title: title, settings: settings, hrefs: map[string]string{}, cover: -1}
+}
+
+// mediaTypeOf returns the media type of a file name, without parameters.
+func mediaTypeOf(name string) string {
+	mediaType, _, _ := strings.Cut(mime.TypeByExtension(strings.ToLower(filepath.Ext(name))), ";")
+	if mediaType == "" {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// addResource copies a file into the publication's media folder, once, and returns its href.
+func (e *Epub) addResource(resourcePath string) (string, error) {
+	key, err := filepath.Abs(resourcePath)
+	if err != nil {
+		key = resourcePath
+	}
+	if href, ok := e.hrefs[key]; ok {
+		return href, nil
+	}
+	content, err := os.ReadFile(resourcePath)
+	if err != nil {
+		return "", err
+	}
+	// Numbered names keep files with the same name from different folders apart.
+	name := regexUnsafeFileName.ReplaceAllString(filepath.Base(resourcePath), "-")
+	href := fmt.Sprintf("media/%d-%s", len(e.resources)+1, name)
+	e.resources = append(e.resources, epubItem{
+		ID:        fmt.Sprintf("media-%d", len(e.resources)+1),
+		Href:      href,
+		MediaType: mediaTypeOf(name),
+		content:   content,
+	})
+	e.hrefs[key] = href
+	return href, nil
+}
+
+// setCover adds an image to the publication and marks it as its cover.
+func (e *Epub) setCover(imagePath string) error {
+	if !IsImage(imagePath) {
+		return fmt.Errorf("cover '%s' is not an image", imagePath)
+	}
+	href, err := e.addResource(imagePath)
+	if err != nil {
+		return fmt.Errorf("failed to read cover image '%s': %w", imagePath, err)
+	}
+	for i := range e.resources {
+		if e.resources[i].Href == href {
+			e.resources[i].Properties = "cover-image"
+			e.cover = i
+		}
+	}
+	return nil
+}
+
+// AddArticle adds an article as the next chapter. Its local images and media, listed in
+// resources, are copied into the publication. The first local cover image of the added
+// articles becomes the cover of the publication.
+func (e *Epub) AddArticle(article Article, resources []string) error {
+	body, err := rewriteResources(article, resources, e.settings, e.addResource)
+	if err != nil {
+		return err
+	}
+	switch {
+	case article.NeedsMathJax && e.settings.RenderMathML:
+		log.Printf("Warning: '%s' contains math that could not be converted to MathML, which e-readers cannot typeset.", article.Title)
+	case article.NeedsMathJax:
+		log.Printf("Warning: '%s' contains math that e-readers cannot typeset. Export with -mathml to convert it to MathML.", article.Title)
+	}
+	properties, err := chapterProperties(body)
+	if err != nil {
+		return fmt.Errorf("failed to parse content of '%s': %w", article.OriginalPath, err)
+	}
+
+	id := fmt.Sprintf("chapter-%d", len(e.chapters)+1)
+	e.chapters = append(e.chapters, epubChapter{
+		epubItem:    epubItem{ID: id, Href: id + ".xhtml", MediaType: "application/xhtml+xml", Properties: properties},
+		Title:       article.Title,
+		Description: article.Description,
+		Created:     article.Created,
+		Body:        body,
+		article:     article,
+	})
+
+	if e.cover < 0 && article.CoverImage != "" && !isAbsoluteURL(article.CoverImage) {
+		coverPath := filepath.Join(filepath.Dir(article.OriginalPath), article.CoverImage)
+		if err := e.setCover(coverPath); err != nil {
+			if !e.settings.IgnoreErrors {
+				return err
+			}
+			log.Printf("Warning: Skipping cover of '%s': %v", article.Title, err)
+		}
+	}
+	return nil
+}
+
+// chapterProperties returns the manifest properties of a chapter with the given body:
+// "mathml" if it contains MathML, as rendered with -mathml, and "remote-resources" if
+// it embeds files from other hosts. Images and interactive elements are left out, as
+// xhtmlContent replaces or removes them.
+func chapterProperties(body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	mathML, remote := false, false
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if n.Data == "img" || slices.Contains(epubNonInteractiveElements, n.Data) {
+				return
+			}
+			mathML = mathML || n.Data == "math"
+			for _, attr := range n.Attr {
+				if slices.Contains(embeddedResourceAttrs[n.Data], attr.Key) && isAbsoluteURL(strings.TrimSpace(attr.Val)) {
+					remote = true
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	var properties []string
+	if mathML {
+		properties = append(properties, "mathml")
+	}
+	if remote {
+		properties = append(properties, "remote-resources")
+	}
+	return strings.Join(properties, " "), nil
+}
+
+// xhtmlContent converts an HTML fragment into well-formed XHTML for a content document.
+// Interactive elements are removed, and remote images, which EPUB readers may not load,
+// are replaced by links to them.
+func xhtmlContent(body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	for _, tag := range epubNonInteractiveElements {
+		for _, n := range findAllElements(doc, tag) {
+			if n.Parent != nil {
+				n.Parent.RemoveChild(n)
+			}
+		}
+	}
+	for _, img := range findAllElements(doc, "img") {
+		src, alt := "", ""
+		for _, attr := range img.Attr {
+			switch attr.Key {
+			case "src":
+				src = attr.Val
+			case "alt":
+				alt = attr.Val
+			}
+		}
+		if !isAbsoluteURL(src) || img.Parent == nil {
+			continue
+		}
+		if alt == "" {
+			alt = src
+		}
+		link := &html.Node{Type: html.ElementNode, Data: "a", Attr: []html.Attribute{{Key: "href", Val: src}}}
+		link.AppendChild(&html.Node{Type: html.TextNode, Data: alt})
+		img.Parent.InsertBefore(link, img)
+		img.Parent.RemoveChild(img)
+	}
+	// html.Render closes void elements ("<br/>") and quotes every attribute, which is valid XML.
+	return getBodyContent(doc)
+}
+
+// identifier derives a stable urn:uuid identifier from the title and chapters, so
+// exporting the same selection again produces the same book for e-reader libraries.
+func (e *Epub) identifier() string {
+	h := sha1.New()
+	h.Write([]byte(e.settings.BaseUrl + "\n" + e.Title))
+	for _, chapter := range e.chapters {
+		h.Write([]byte("\n" + chapter.article.LinkToSelf))
+	}
+	sum := h.Sum(nil)
+	sum[6] = (sum[6] & 0x0f) | 0x50 // Version 5 (name-based, SHA-1)
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// Write packages the publication into an EPUB file at destPath, with a table of contents
+// and the metadata of the settings (title, author, publisher, language). Without a cover
+// from the articles, the publisher logo is used when it is a local image. Links between
+// the added articles are rewritten to point to their chapters.
+func (e *Epub) Write(destPath string, tmpl *texttemplate.Template, assets fs.FS) error {
+	if len(e.chapters) == 0 {
+		return fmt.Errorf("no articles to export")
+	}
+	if e.cover < 0 && e.settings.PublisherLogoPath != "" && !isAbsoluteURL(e.settings.PublisherLogoPath) {
+		if err := e.setCover(e.settings.PublisherLogoPath); err != nil {
+			if !e.settings.IgnoreErrors {
+				return err
+			}
+			log.Printf("Warning: Skipping cover: %v", err)
+		}
+	}
+
+	targets := map[string]string{}
+	modified := time.Time{}
+	for _, chapter := range e.chapters {
+		for _, key := range ArticleLinkKeys(chapter.article, e.settings) {
+			targets[key] = chapter.Href
+		}
+		if chapter.article.Updated.After(modified) {
+			modified = chapter.article.Updated
+		}
+	}
+
+	var cover *epubItem
+	if e.cover >= 0 {
+		cover = &e.resources[e.cover]
+	}
+	data := struct {
+		Title      string
+		Identifier string
+		Modified   string
+		Settings   Settings
+		Chapters   []epubChapter
+		Resources  []epubItem
+		Cover      *epubItem
+	}{
+		Title:      e.Title,
+		Identifier: e.identifier(),
+		Modified:   modified.UTC().Format("2006-01-02T15:04:05Z"),
+		Settings:   e.settings,
+		Chapters:   e.chapters,
+		Resources:  e.resources,
+		Cover:      cover,
+	}
+
+	render := func(name string, data any) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+			return nil, fmt.Errorf("error executing EPUB template '%s': %w", name, err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	type entry struct {
+		name    string
+		content []byte
+	}
+	var entries []entry
+	add := func(name string, content []byte) {
+		entries = append(entries, entry{name, content})
+	}
+
+	container, err := render("container", data)
+	if err != nil {
+		return err
+	}
+	add("META-INF/container.xml", container)
+	for _, doc := range []struct{ template, name string }{{"package", "content.opf"}, {"nav", "nav.xhtml"}} {
+		content, err := render(doc.template, data)
+		if err != nil {
+			return err
+		}
+		add(path.Join(epubContentDir, doc.name), content)
+	}
+	if cover != nil {
+		content, err := render("cover", data)
+		if err != nil {
+			return err
+		}
+		add(path.Join(epubContentDir, "cover.xhtml"), content)
+	}
+
+	style, err := fs.ReadFile(assets, "src/assets/epub.css")
+	if err != nil {
+		return fmt.Errorf("error reading EPUB stylesheet: %w", err)
+	}
+	// E-readers mostly use light backgrounds, whatever the site theme.
+	highlight, err := GenerateHighlightCSS(HighlightStyleForThemeType("light"))
+	if err != nil {
+		return fmt.Errorf("error generating syntax highlighting CSS: %w", err)
+	}
+	add(path.Join(epubContentDir, "style.css"), append(append(style, '\n'), highlight...))
+
+	for _, chapter := range e.chapters {
+		body, err := RewriteInternalLinks(chapter.article, chapter.Body, targets, e.settings)
+		if err != nil {
+			return err
+		}
+		if chapter.Body, err = xhtmlContent(body); err != nil {
+			return fmt.Errorf("failed to convert '%s' to XHTML: %w", chapter.article.OriginalPath, err)
+		}
+		content, err := render("chapter", struct {
+			Chapter  epubChapter
+			Settings Settings
+		}{chapter, e.settings})
+		if err != nil {
+			return err
+		}
+		add(path.Join(epubContentDir, chapter.Href), content)
+	}
+	for _, resource := range e.resources {
+		add(path.Join(epubContentDir, resource.Href), resource.content)
+	}
+
+	f, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to create '%s': %w", destPath, err)
+	}
+	zw := zip.NewWriter(f)
+	// The mimetype file must come first and be stored uncompressed, so readers can identify
+	// the format from the first bytes of the archive.
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err == nil {
+		_, err = w.Write([]byte(EpubMimeType))
+	}
+	for _, entry := range entries {
+		if err != nil {
+			break
+		}
+		if w, err = zw.Create(entry.name); err == nil {
+			_, err = w.Write(entry.content)
+		}
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write EPUB '%s': %w", destPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package parse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// AssetManifestName is the file name of the JSON manifest mapping logical asset
+// names to their fingerprinted file names.
+const AssetManifestName = "asset-manifest.json"
+
+// fingerprintLength is the number of hex characters of the content hash kept in file names.
+const fingerprintLength = 8
+
+// FingerprintedName inserts a short content hash before the extension of name
+// (e.g. "style.css" -> "style.3f9a1c2b.css").
+func FingerprintedName(name string, content []byte) string {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])[:fingerprintLength]
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// FingerprintAsset renames outputDirectory/name to its fingerprinted name and returns
+// the new name, relative to outputDirectory. If keepOriginal is true, the file is
+// also kept under its original name (e.g. favicon.ico, which clients request directly).
+func FingerprintAsset(outputDirectory string, name string, keepOriginal bool) (string, error) {
+	srcPath := filepath.Join(outputDirectory, filepath.FromSlash(name))
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read asset '%s' for fingerprinting: %w", srcPath, err)
+	}
+
+	fingerprinted := FingerprintedName(name, content)
+	destPath := filepath.Join(outputDirectory, filepath.FromSlash(fingerprinted))
+	if err := os.WriteFile(destPath, content, 0644); err != nil {
+		return "", fmt.Errorf("failed to write fingerprinted asset '%s': %w", destPath, err)
+	}
+	if !keepOriginal {
+		if err := os.Remove(srcPath); err != nil {
+			return "", fmt.Errorf("failed to remove asset '%s' after fingerprinting: %w", srcPath, err)
+		}
+	}
+	return fingerprinted, nil
+}
+
+// assetPath resolves a logical asset name (e.g. "style.css", or the path of a share
+// icon) to its fingerprinted path relative to the site root. Names missing from the
+// manifest, such as absolute URLs, are returned unchanged.
+// It is registered as "assetPath" in templates.
+func assetPath(name string, settings Settings) string {
+	if fingerprinted, ok := settings.AssetManifest[name]; ok {
+		return fingerprinted
+	}
+	if fingerprinted, ok := settings.AssetManifest[path.Base(filepath.ToSlash(name))]; ok {
+		return fingerprinted
+	}
+	return name
+}
+
+// SaveAssetManifest writes the manifest of fingerprinted assets as JSON into the output directory.
+func SaveAssetManifest(manifest map[string]string, outputDirectory string) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling asset manifest: %w", err)
+	}
+	destPath := filepath.Join(outputDirectory, AssetManifestName)
+	if err := os.WriteFile(destPath, content, 0644); err != nil {
+		return fmt.Errorf("error writing asset manifest '%s': %w", destPath, err)
+	}
+	return nil
+}
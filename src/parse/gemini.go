@@ -0,0 +1,457 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/k3a/html2text"
+	mathjax "github.com/litao91/goldmark-mathjax"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// GeminiDirName is the folder of the output directory holding the Gemini capsule.
+const GeminiDirName = "gemini"
+
+// regexBlankLines matches runs of blank lines collapsed in generated gemtext.
+var regexBlankLines = regexp.MustCompile(`\n{3,}`)
+
+// gemLink is a link hoisted out of running text onto its own "=>" line.
+type gemLink struct {
+	url   string
+	label string
+}
+
+// gemtextWriter converts a Goldmark AST into gemtext. Gemtext has no inline links, so the
+// links of each block are listed as "=>" lines right after it.
+type gemtextWriter struct {
+	source []byte
+	buf    strings.Builder
+	link   func(destination string) string // Maps a Markdown destination to the URL to use
+}
+
+// line writes one line of gemtext.
+func (w *gemtextWriter) line(s string) {
+	w.buf.WriteString(s)
+	w.buf.WriteByte('\n')
+}
+
+// links writes the hoisted links of a block.
+func (w *gemtextWriter) links(links []gemLink) {
+	for _, l := range links {
+		if l.label == "" || l.label == l.url {
+			w.line("=> " + l.url)
+		} else {
+			w.line("=> " + l.url + " " + l.label)
+		}
+	}
+}
+
+// preformatted writes lines as a preformatted block, with alt as its caption.
+func (w *gemtextWriter) preformatted(alt string, lines []string) {
+	w.line("```" + alt)
+	for _, l := range lines {
+		w.line(l)
+	}
+	w.line("```")
+	w.line("")
+}
+
+// rawLines returns the source lines of a block node, without trailing newlines.
+func (w *gemtextWriter) rawLines(n ast.Node) []string {
+	var lines []string
+	for i := 0; i < n.Lines().Len(); i++ {
+		segment := n.Lines().At(i)
+		lines = append(lines, strings.TrimRight(string(segment.Value(w.source)), "\r\n"))
+	}
+	return lines
+}
+
+// inline returns the text of the inline children of n, collecting their links.
+func (w *gemtextWriter) inline(n ast.Node, links *[]gemLink) string {
+	var sb strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			if c.IsRaw() { // Code spans and math
+				sb.Write(c.Segment.Value(w.source))
+			} else {
+				sb.Write(util.UnescapePunctuations(c.Segment.Value(w.source)))
+			}
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				sb.WriteByte('\n')
+			}
+		case *ast.String:
+			if c.IsCode() {
+				sb.WriteString(html2text.HTML2Text(string(c.Value)))
+			} else {
+				sb.Write(c.Value)
+			}
+		case *ast.CodeSpan:
+			sb.WriteString("`" + w.inline(c, links) + "`")
+		case *mathjax.InlineMath:
+			sb.WriteString("$" + strings.ReplaceAll(w.inline(c, links), "\n", " ") + "$")
+		case *ast.Link:
+			label := w.inline(c, links)
+			sb.WriteString(label)
+			*links = append(*links, gemLink{w.link(string(c.Destination)), oneLine(label)})
+		case *ast.AutoLink:
+			destination := string(c.URL(w.source))
+			sb.WriteString(string(c.Label(w.source)))
+			*links = append(*links, gemLink{w.link(destination), string(c.Label(w.source))})
+		case *ast.Image:
+			var altLinks []gemLink
+			alt := oneLine(w.inline(c, &altLinks))
+			if alt == "" {
+				alt = path.Base(string(c.Destination))
+			}
+			*links = append(*links, gemLink{w.link(string(c.Destination)), alt})
+		case *extast.TaskCheckBox:
+			if c.IsChecked {
+				sb.WriteString("[x] ")
+			} else {
+				sb.WriteString("[ ] ")
+			}
+		case *extast.FootnoteLink:
+			sb.WriteString("[" + strconv.Itoa(c.Index) + "]")
+		case *ast.RawHTML, *extast.FootnoteBacklink:
+		default:
+			sb.WriteString(w.inline(c, links))
+		}
+	}
+	return sb.String()
+}
+
+// oneLine joins the lines of s with spaces.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// block writes a block node and its children.
+func (w *gemtextWriter) block(n ast.Node) {
+	var links []gemLink
+	switch n := n.(type) {
+	case *ast.Heading:
+		w.line(strings.Repeat("#", min(n.Level, 3)) + " " + oneLine(w.inline(n, &links)))
+		w.links(links)
+		w.line("")
+	case *ast.Paragraph, *ast.TextBlock:
+		if text := strings.TrimSpace(w.inline(n, &links)); text != "" {
+			w.line(text)
+		}
+		w.links(links)
+		w.line("")
+	case *ast.List:
+		w.list(n)
+		w.line("")
+	case *ast.Blockquote, *calloutNode:
+		quote := gemtextWriter{source: w.source, link: w.link}
+		if callout, ok := n.(*calloutNode); ok {
+			quote.line(callout.Title)
+			quote.line("")
+		}
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			quote.block(c)
+		}
+		preformatted := false
+		for _, l := range strings.Split(strings.TrimSpace(quote.buf.String()), "\n") {
+			switch {
+			case strings.HasPrefix(l, "```"):
+				preformatted = !preformatted
+				w.line(l)
+			case preformatted || l == "" || strings.HasPrefix(l, "=>"):
+				w.line(l)
+			default:
+				w.line("> " + l)
+			}
+		}
+		w.line("")
+	case *ast.FencedCodeBlock:
+		w.preformatted(string(n.Language(w.source)), w.rawLines(n))
+	case *ast.CodeBlock:
+		w.preformatted("", w.rawLines(n))
+	case *mathjax.MathBlock:
+		w.preformatted("math", w.rawLines(n))
+	case *ast.HTMLBlock:
+		raw := strings.Join(w.rawLines(n), "\n")
+		if n.HasClosure() {
+			raw += "\n" + string(n.ClosureLine.Value(w.source))
+		}
+		if text := strings.TrimSpace(html2text.HTML2Text(raw)); text != "" {
+			w.line(text)
+			w.line("")
+		}
+	case *extast.Table:
+		w.table(n)
+	case *extast.FootnoteList:
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			if footnote, ok := c.(*extast.Footnote); ok {
+				w.line("[" + strconv.Itoa(footnote.Index) + "] " + oneLine(w.inline(footnote, &links)))
+			}
+		}
+		w.links(links)
+		w.line("")
+	case *ast.ThematicBreak:
+		w.line("")
+	default:
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			w.block(c)
+		}
+	}
+}
+
+// list writes the items of a list as "*" lines, flattening nested lists. Ordered items
+// keep their number, as gemtext has no ordered lists.
+func (w *gemtextWriter) list(n *ast.List) {
+	number := n.Start
+	for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := "* "
+		if n.IsOrdered() {
+			marker = "* " + strconv.Itoa(number) + ". "
+			number++
+		}
+		for c := item.FirstChild(); c != nil; c = c.NextSibling() {
+			switch c := c.(type) {
+			case *ast.List:
+				w.list(c)
+			case *ast.Paragraph, *ast.TextBlock:
+				var links []gemLink
+				w.line(marker + oneLine(w.inline(c, &links)))
+				w.links(links)
+				marker = "* "
+			default:
+				w.block(c)
+			}
+		}
+	}
+}
+
+// table writes a table as a preformatted block with aligned columns.
+func (w *gemtextWriter) table(n *extast.Table) {
+	var links []gemLink
+	var rows [][]string
+	var widths []int
+	for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+		var cells []string
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			text := oneLine(w.inline(cell, &links))
+			if i := len(cells); i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[len(cells)] = max(widths[len(cells)], utf8.RuneCountInString(text))
+			cells = append(cells, text)
+		}
+		rows = append(rows, cells)
+	}
+	var lines []string
+	for i, cells := range rows {
+		for j := range cells {
+			cells[j] += strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cells[j]))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cells, " | "), " "))
+		if i == 0 {
+			var rule []string
+			for _, width := range widths {
+				rule = append(rule, strings.Repeat("-", width))
+			}
+			lines = append(lines, strings.Join(rule, "-|-"))
+		}
+	}
+	w.preformatted("table", lines)
+	w.links(links)
+	w.line("")
+}
+
+// relativeLink returns a link from a page in fromDir to target, both relative to the
+// root of the capsule.
+func relativeLink(fromDir string, target string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(fromDir), filepath.FromSlash(target))
+	if err != nil {
+		return "/" + target
+	}
+	return filepath.ToSlash(rel)
+}
+
+// geminiEntry is an article listed in the capsule's index and feed.
+type geminiEntry struct {
+	Art  Article
+	Path string // Path of the article's page, relative to the capsule root
+}
+
+// GemtextFile converts the Markdown source of article into the gemtext body of its
+// capsule page. Links to other articles, found in targets (see ArticleLinkKeys), point
+// to their pages; local resources are copied next to the page; other links to the site
+// point to the web version.
+func GemtextFile(article Article, targets map[string]string, settings Settings) (string, error) {
+	data, err := os.ReadFile(article.OriginalPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Markdown file '%s': %w", article.OriginalPath, err)
+	}
+	doc := MarkdownFor(settings).Parser().Parse(text.NewReader(data), parser.WithContext(newParserContext(article.OriginalPath, settings)))
+
+	capsuleRoot := filepath.Join(settings.OutputPath, GeminiDirName)
+	pageDir := path.Dir(alternatePath(article, settings, ".gmi"))
+	resolver := newLinkResolver(article, targets, settings)
+	var copyErr error
+
+	w := gemtextWriter{source: data}
+	w.link = func(destination string) string {
+		u, err := url.Parse(strings.TrimSpace(destination))
+		if err != nil {
+			return destination
+		}
+		sitePath, target, inSite := resolver.resolve(u)
+		switch {
+		case !inSite:
+			return destination
+		case target != "":
+			return relativeLink(pageDir, target)
+		}
+		if cleanPath, ok := localResourcePath(destination); ok && !u.IsAbs() && u.Host == "" {
+			src := filepath.Join(filepath.Dir(article.OriginalPath), cleanPath)
+			if err := copyFileTo(src, filepath.Join(capsuleRoot, filepath.FromSlash(pageDir), cleanPath)); err == nil {
+				return EncodePathSegments(cleanPath)
+			} else if !settings.IgnoreErrors {
+				copyErr = fmt.Errorf("failed to copy resource '%s' (referenced in '%s'): %w", src, article.Title, err)
+			} else {
+				log.Printf("Warning: Failed to copy resource '%s' (referenced in '%s'): %v", src, article.Title, err)
+			}
+		}
+		u.Scheme, u.Host, u.Path = "", "", "/"+sitePath
+		return settings.BaseUrl + u.RequestURI() + fragmentSuffix(u)
+	}
+	w.block(doc)
+	if copyErr != nil {
+		return "", copyErr
+	}
+	return strings.TrimSpace(regexBlankLines.ReplaceAllString(w.buf.String(), "\n\n")), nil
+}
+
+// copyFileTo copies the file at src to dest, creating dest's folder.
+func copyFileTo(src string, dest string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dest, content, 0644)
+}
+
+// GenerateGemini writes a Gemini capsule into the GeminiDirName folder of the output
+// directory: a gemtext page for every Markdown article, at the same paths as the HTML
+// pages, an index.gmi listing them, and an Atom feed. HTML articles, which have no
+// Markdown to convert, are left out.
+func GenerateGemini(articles []Article, settings Settings, tmpl *texttemplate.Template) error {
+	capsuleRoot := filepath.Join(settings.OutputPath, GeminiDirName)
+
+	var entries []geminiEntry
+	targets := map[string]string{}
+	for _, article := range articles {
+		if !strings.EqualFold(filepath.Ext(article.OriginalPath), ".md") {
+			continue
+		}
+		entry := geminiEntry{Art: article, Path: alternatePath(article, settings, ".gmi")}
+		entries = append(entries, entry)
+		for _, key := range ArticleLinkKeys(article, settings) {
+			targets[key] = entry.Path
+		}
+	}
+
+	render := func(name string, filePath string, data any) error {
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+			return fmt.Errorf("error executing Gemini template '%s': %w", name, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for '%s': %w", filePath, err)
+		}
+		if err := os.WriteFile(filePath, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error writing '%s': %w", filePath, err)
+		}
+		return nil
+	}
+
+	for _, entry := range entries {
+		body, err := GemtextFile(entry.Art, targets, settings)
+		if err != nil {
+			return err
+		}
+		webUrl := entry.Art.CanonicalUrl
+		if webUrl == "" {
+			webUrl = settings.BaseUrl + "/" + EncodePathSegments(entry.Art.LinkToSelf)
+		}
+		err = render("article", filepath.Join(capsuleRoot, filepath.FromSlash(entry.Path)), struct {
+			Art      Article
+			Body     string
+			Home     string
+			WebUrl   string
+			Settings Settings
+		}{
+			Art:      entry.Art,
+			Body:     body,
+			Home:     relativeLink(path.Dir(entry.Path), "index.gmi"),
+			WebUrl:   webUrl,
+			Settings: settings,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var pages, posts []geminiEntry
+	for _, entry := range entries {
+		if slices.Contains(entry.Art.Tags, "PAGE") {
+			pages = append(pages, entry)
+		} else {
+			posts = append(posts, entry)
+		}
+	}
+	description := strings.TrimSpace(html2text.HTML2Text(string(settings.DescriptionHTML)))
+	err := render("index", filepath.Join(capsuleRoot, "index.gmi"), struct {
+		Description string
+		Pages       []geminiEntry
+		Posts       []geminiEntry
+		Settings    Settings
+	}{description, pages, posts, settings})
+	if err != nil {
+		return err
+	}
+
+	// The feed lists the newest posts first, whatever the order of the index.
+	feed := slices.Clone(posts)
+	slices.SortStableFunc(feed, func(a, b geminiEntry) int {
+		return b.Art.Created.Compare(a.Art.Created)
+	})
+	updated := time.Now()
+	if len(feed) > 0 {
+		updated = feed[0].Art.Created
+		for _, entry := range feed {
+			if entry.Art.Updated.After(updated) {
+				updated = entry.Art.Updated
+			}
+		}
+	}
+	return render("atom", filepath.Join(capsuleRoot, "atom.xml"), struct {
+		Description string
+		Updated     time.Time
+		Posts       []geminiEntry
+		Settings    Settings
+	}{description, updated, feed, settings})
+}
@@ -0,0 +1,76 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// GraphFileName is the file of the output directory describing how articles link to
+// each other and to their tags, for graph views of the site.
+const GraphFileName = "graph.json"
+
+// graphNode is an article or a tag of the site graph.
+type graphNode struct {
+	ID    string `json:"id"`   // LinkToSelf of articles, "tag:" and the name of tags
+	Type  string `json:"type"` // "article" or "tag"
+	Title string `json:"title"`
+	URL   string `json:"url,omitempty"`   // Site-root-relative page of articles
+	Count int    `json:"count,omitempty"` // Articles having a tag
+}
+
+// graphEdge joins an article to an article it links to, or to one of its tags.
+type graphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"` // "link" or "tag"
+}
+
+// siteGraph is the content of GraphFileName.
+type siteGraph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+// GenerateGraph writes GraphFileName: a node for every article and tag but PAGE, and edges
+// for the links between articles (see LinkArticles) and from articles to their tags.
+func GenerateGraph(articles []Article, settings Settings) error {
+	graph := siteGraph{Nodes: []graphNode{}, Edges: []graphEdge{}}
+	tagNodes := map[string]int{}
+	for _, article := range articles {
+		graph.Nodes = append(graph.Nodes, graphNode{
+			ID:    article.LinkToSelf,
+			Type:  "article",
+			Title: article.Title,
+			URL:   article.LinkToSelf,
+		})
+	}
+	for _, article := range articles {
+		for _, target := range article.Links {
+			graph.Edges = append(graph.Edges, graphEdge{Source: article.LinkToSelf, Target: target, Type: "link"})
+		}
+		for _, tag := range article.Tags {
+			if tagKey(tag) == "" {
+				continue // The PAGE tag only marks pages
+			}
+			id := "tag:" + tag
+			if i, ok := tagNodes[id]; ok {
+				graph.Nodes[i].Count++
+			} else {
+				tagNodes[id] = len(graph.Nodes)
+				graph.Nodes = append(graph.Nodes, graphNode{ID: id, Type: "tag", Title: tag, Count: 1})
+			}
+			graph.Edges = append(graph.Edges, graphEdge{Source: article.LinkToSelf, Target: id, Type: "tag"})
+		}
+	}
+
+	data, err := json.Marshal(graph)
+	if err != nil {
+		return fmt.Errorf("failed to encode site graph: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(settings.OutputPath, GraphFileName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", GraphFileName, err)
+	}
+	return nil
+}
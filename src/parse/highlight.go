@@ -0,0 +1,105 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Chroma styles used for code blocks, chosen according to the theme's color scheme.
+const (
+	HighlightStyleLight = "github"
+	HighlightStyleDark  = "github-dark"
+)
+
+// HighlightStylesheetName is the file name of the generated syntax highlighting stylesheet.
+const HighlightStylesheetName = "highlight.css"
+
+// highlightFormatterOptions returns the Chroma HTML formatter options shared by the
+// Markdown renderer and the stylesheet generator, so classes always match.
+func highlightFormatterOptions() []chromahtml.Option {
+	return []chromahtml.Option{
+		chromahtml.WithClasses(true),
+		chromahtml.WithLineNumbers(false),
+		chromahtml.TabWidth(4),
+	}
+}
+
+// HighlightStyleForThemeType maps a theme type ("light" or "dark") to a Chroma style name.
+func HighlightStyleForThemeType(themeType string) string {
+	if themeType == "light" {
+		return HighlightStyleLight
+	}
+	return HighlightStyleDark
+}
+
+// GenerateHighlightCSS renders the stylesheet for the given Chroma style.
+// Unknown style names fall back to Chroma's default style.
+func GenerateHighlightCSS(styleName string) ([]byte, error) {
+	style := styles.Get(styleName)
+	// Line number rules are only emitted when the formatter has line numbers enabled,
+	// so the stylesheet is generated with them on to cover fenced blocks using `linenos`.
+	options := append(highlightFormatterOptions(), chromahtml.WithLineNumbers(true))
+	formatter := chromahtml.New(options...)
+
+	var buf bytes.Buffer
+	if err := formatter.WriteCSS(&buf, style); err != nil {
+		return nil, fmt.Errorf("failed to generate CSS for highlight style '%s': %w", styleName, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SaveHighlightCSS writes the syntax highlighting stylesheet for styleName into the output directory.
+func SaveHighlightCSS(styleName string, outputDirectory string) error {
+	css, err := GenerateHighlightCSS(styleName)
+	if err != nil {
+		return err
+	}
+	destPath := filepath.Join(outputDirectory, HighlightStylesheetName)
+	if err := os.WriteFile(destPath, css, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", HighlightStylesheetName, err)
+	}
+	return nil
+}
+
+// highlightInlineStyles maps Chroma CSS classes to inline style declarations for styleName.
+// It is used where external stylesheets are unavailable, such as RSS readers.
+func highlightInlineStyles(styleName string) map[string]string {
+	style := styles.Get(styleName)
+	bg := style.Get(chroma.Background)
+
+	inline := map[string]string{
+		"chroma": chromahtml.StyleEntryToCSS(bg),
+	}
+	for tokenType, class := range chroma.StandardTypes {
+		if class == "" || tokenType == chroma.Background || tokenType == chroma.PreWrapper {
+			continue
+		}
+		entry := style.Get(tokenType).Sub(bg)
+		if entry.IsZero() {
+			continue
+		}
+		if css := chromahtml.StyleEntryToCSS(entry); css != "" {
+			inline[class] = css
+		}
+	}
+	return inline
+}
+
+// inlineHighlightStyle returns the inline CSS for a space-separated class attribute value,
+// or an empty string if none of the classes belong to the highlighter.
+func inlineHighlightStyle(classAttr string, inline map[string]string) string {
+	var declarations []string
+	for _, class := range strings.Fields(classAttr) {
+		if css, ok := inline[class]; ok {
+			declarations = append(declarations, css)
+		}
+	}
+	return strings.Join(declarations, "; ")
+}
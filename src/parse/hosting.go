@@ -0,0 +1,361 @@
+package parse
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// NotFoundPageName is the output name of the custom 404 page. Netlify, Cloudflare Pages
+// and GitHub Pages pick up a root-level 404.html without further configuration.
+const NotFoundPageName = "404.html"
+
+// Output names of the generated hosting configuration files.
+const (
+	HeadersFileName   = "_headers"
+	RedirectsFileName = "_redirects"
+	HtaccessFileName  = ".htaccess"
+	NginxConfFileName = "dsbg.nginx.conf"
+)
+
+// Supported hosting targets for the -hosting flag.
+const (
+	HostingNetlify    = "netlify"
+	HostingCloudflare = "cloudflare"
+	HostingApache     = "apache"
+	HostingNginx      = "nginx"
+)
+
+var hostingTargets = []string{HostingNetlify, HostingCloudflare, HostingApache, HostingNginx}
+
+// ParseHostingTargets validates a comma-separated list of hosting targets. "all" selects every target.
+func ParseHostingTargets(s string) ([]string, error) {
+	var targets []string
+	for _, target := range strings.Split(s, ",") {
+		target = strings.ToLower(strings.TrimSpace(target))
+		switch {
+		case target == "":
+			continue
+		case target == "all":
+			return slices.Clone(hostingTargets), nil
+		case slices.Contains(hostingTargets, target):
+			if !slices.Contains(targets, target) {
+				targets = append(targets, target)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported hosting target: %s", target)
+		}
+	}
+	return targets, nil
+}
+
+// IsNotFoundSource reports whether a content file, relative to the input directory,
+// is the custom 404 page (404.md or 404.html at the root of the input directory).
+func IsNotFoundSource(relativeInputPath string) bool {
+	name := filepath.ToSlash(relativeInputPath)
+	return strings.EqualFold(strings.TrimSuffix(name, path.Ext(name)), "404")
+}
+
+// InjectBaseHref inserts a <base href> tag at the start of <head>, so the relative
+// links of a page served at arbitrary URLs (such as the 404 page) resolve from baseUrl.
+func InjectBaseHref(htmlContent string, baseUrl string) string {
+	index := strings.Index(strings.ToLower(htmlContent), "<head>")
+	if index < 0 {
+		return htmlContent
+	}
+	index += len("<head>")
+	baseTag := fmt.Sprintf(`<base href="%s/">`, strings.NewReplacer("&", "&amp;", `"`, "&quot;").Replace(baseUrl))
+	return htmlContent[:index] + "\n    " + baseTag + htmlContent[index:]
+}
+
+// Redirect is a permanent or temporary redirect between two site-root-relative paths
+// (or from a path to an absolute URL).
+type Redirect struct {
+	From   string
+	To     string
+	Status int
+}
+
+// Header is a single HTTP response header.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// CacheRule assigns a Cache-Control value to a group of file extensions.
+type CacheRule struct {
+	Name         string
+	Extensions   []string
+	CacheControl string
+}
+
+// ImmutableCacheControl is used for fingerprinted assets, whose content never changes under a given name.
+const ImmutableCacheControl = "public, max-age=31536000, immutable"
+
+// DefaultCacheRules are the per-file-type caching policies applied by every hosting target.
+var DefaultCacheRules = []CacheRule{
+	{Name: "Pages", Extensions: []string{"html"}, CacheControl: "public, max-age=0, must-revalidate"},
+	{Name: "Feeds and data", Extensions: []string{"xml", "json", "txt"}, CacheControl: "public, max-age=3600"},
+	{Name: "Media and fonts", Extensions: []string{"png", "jpg", "jpeg", "gif", "webp", "avif", "svg", "ico", "mp4", "webm", "mp3", "ogg", "pdf", "woff", "woff2"}, CacheControl: "public, max-age=604800"},
+}
+
+// DefaultSecurityHeaders are sent with every response.
+var DefaultSecurityHeaders = []Header{
+	{Name: "X-Content-Type-Options", Value: "nosniff"},
+	{Name: "X-Frame-Options", Value: "SAMEORIGIN"},
+	{Name: "Referrer-Policy", Value: "strict-origin-when-cross-origin"},
+	{Name: "Permissions-Policy", Value: "camera=(), microphone=(), geolocation=()"},
+}
+
+// fingerprintPattern matches the content hash inserted by FingerprintedName.
+var fingerprintPattern = fmt.Sprintf(`\.[0-9a-f]{%d}\.`, fingerprintLength)
+
+// HostingConfig is a provider-independent description of how the generated site
+// should be served. The Save* functions translate it into provider-specific files.
+type HostingConfig struct {
+	Redirects       []Redirect
+	NotFoundPage    string   // Site-root-relative path of the custom 404 page, empty if none
+	SecurityHeaders []Header // Sent with every response
+	CacheRules      []CacheRule
+	Immutable       []string // Site-root-relative paths of fingerprinted assets
+	Precompressed   bool     // Whether .br/.gz siblings were written
+}
+
+// NewHostingConfig describes the site in outputDirectory: its redirects, custom 404 page
+// and fingerprinted assets. If policy is not nil, it is sent as the Content-Security-Policy
+// header.
+func NewHostingConfig(settings Settings, redirects []Redirect, policy CSP) (HostingConfig, error) {
+	// Paths in the configuration are URL paths, so they include the base path.
+	prefix := settings.BasePath
+	config := HostingConfig{
+		SecurityHeaders: slices.Clone(DefaultSecurityHeaders),
+		CacheRules:      DefaultCacheRules,
+		Precompressed:   settings.Precompress,
+	}
+	for _, redirect := range redirects {
+		redirect.From = prefix + redirect.From
+		if !isAbsoluteURL(redirect.To) {
+			redirect.To = prefix + redirect.To
+		}
+		config.Redirects = append(config.Redirects, redirect)
+	}
+	if policy != nil {
+		config.SecurityHeaders = append(config.SecurityHeaders, Header{Name: "Content-Security-Policy", Value: policy.String()})
+	}
+	if _, err := os.Stat(filepath.Join(settings.OutputPath, NotFoundPageName)); err == nil {
+		config.NotFoundPage = prefix + "/" + NotFoundPageName
+	}
+	for _, name := range settings.AssetManifest {
+		config.Immutable = append(config.Immutable, prefix+"/"+name)
+	}
+	sort.Strings(config.Immutable)
+	return config, nil
+}
+
+// extensionCacheControl returns the Cache-Control value of the rule for the extension of
+// a site-root-relative path, or an empty string if no rule applies.
+func (c HostingConfig) extensionCacheControl(p string) string {
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(p)), ".")
+	for _, rule := range c.CacheRules {
+		if slices.Contains(rule.Extensions, ext) {
+			return rule.CacheControl
+		}
+	}
+	return ""
+}
+
+// writeHostingFile writes content to name in the output directory.
+func writeHostingFile(outputDirectory string, name string, content string) error {
+	destPath := filepath.Join(outputDirectory, name)
+	if err := os.WriteFile(destPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing hosting file '%s': %w", destPath, err)
+	}
+	return nil
+}
+
+// SaveHeadersFile writes a Netlify/Cloudflare Pages _headers file. Cache rules become
+// one splat per extension (e.g. "/*.png"), so the file stays within Cloudflare's limit
+// of 100 rules whatever the size of the site. Splats match across folders, so they also
+// cover a base path. Fingerprinted assets follow with their immutable policy, first
+// detaching the Cache-Control of their extension, which Cloudflare would otherwise join
+// with it.
+func SaveHeadersFile(config HostingConfig, outputDirectory string) error {
+	var b strings.Builder
+	b.WriteString("# Generated by DSBG.\n/*\n")
+	for _, header := range config.SecurityHeaders {
+		fmt.Fprintf(&b, "  %s: %s\n", header.Name, header.Value)
+	}
+	for _, rule := range config.CacheRules {
+		// Pages already get the providers' default revalidation; listing them would only add noise.
+		if slices.Contains(rule.Extensions, "html") {
+			continue
+		}
+		fmt.Fprintf(&b, "# %s\n", rule.Name)
+		for _, ext := range rule.Extensions {
+			fmt.Fprintf(&b, "/*.%s\n  Cache-Control: %s\n", ext, rule.CacheControl)
+		}
+	}
+	if len(config.Immutable) > 0 {
+		b.WriteString("# Fingerprinted assets\n")
+	}
+	for _, file := range config.Immutable {
+		fmt.Fprintf(&b, "%s\n", file)
+		if config.extensionCacheControl(file) != "" {
+			b.WriteString("  ! Cache-Control\n")
+		}
+		fmt.Fprintf(&b, "  Cache-Control: %s\n", ImmutableCacheControl)
+	}
+	return writeHostingFile(outputDirectory, HeadersFileName, b.String())
+}
+
+// SaveRedirectsFile writes a Netlify/Cloudflare Pages _redirects file.
+// Both providers serve a root-level 404.html automatically, so no rule is needed for it.
+func SaveRedirectsFile(config HostingConfig, outputDirectory string) error {
+	var b strings.Builder
+	b.WriteString("# Generated by DSBG.\n")
+	for _, redirect := range config.Redirects {
+		fmt.Fprintf(&b, "%s  %s  %d\n", redirect.From, redirect.To, redirect.Status)
+	}
+	return writeHostingFile(outputDirectory, RedirectsFileName, b.String())
+}
+
+// extensionPattern returns a regular expression alternation of the rule's extensions.
+func extensionPattern(rule CacheRule) string {
+	return `\.(` + strings.Join(rule.Extensions, "|") + `)$`
+}
+
+// exactPathPattern returns an anchored regular expression matching p with or without a trailing slash.
+func exactPathPattern(p string) string {
+	return "^" + regexp.QuoteMeta(strings.TrimSuffix(p, "/")) + "/?$"
+}
+
+// SaveHtaccess writes an Apache .htaccess file.
+func SaveHtaccess(config HostingConfig, outputDirectory string) error {
+	var b strings.Builder
+	b.WriteString("# Generated by DSBG.\n\n")
+	if config.NotFoundPage != "" {
+		fmt.Fprintf(&b, "ErrorDocument 404 %s\n\n", config.NotFoundPage)
+	}
+
+	if len(config.Redirects) > 0 {
+		b.WriteString("<IfModule mod_alias.c>\n")
+		for _, redirect := range config.Redirects {
+			fmt.Fprintf(&b, "    RedirectMatch %d %s %s\n", redirect.Status, exactPathPattern(redirect.From), redirect.To)
+		}
+		b.WriteString("</IfModule>\n\n")
+	}
+
+	b.WriteString("<IfModule mod_headers.c>\n")
+	for _, header := range config.SecurityHeaders {
+		fmt.Fprintf(&b, "    Header always set %s \"%s\"\n", header.Name, header.Value)
+	}
+	for _, rule := range config.CacheRules {
+		fmt.Fprintf(&b, "    # %s\n    <FilesMatch \"%s\">\n        Header set Cache-Control \"%s\"\n    </FilesMatch>\n", rule.Name, extensionPattern(rule), rule.CacheControl)
+	}
+	// Listed last so it overrides the per-type rules for fingerprinted files.
+	fmt.Fprintf(&b, "    # Fingerprinted assets\n    <FilesMatch \"%s\">\n        Header set Cache-Control \"%s\"\n    </FilesMatch>\n", fingerprintPattern, ImmutableCacheControl)
+	b.WriteString("</IfModule>\n")
+
+	if config.Precompressed {
+		b.WriteString(`
+# Serve precompressed siblings written by -precompress.
+<IfModule mod_rewrite.c>
+    RewriteEngine On
+    RewriteCond %{HTTP:Accept-Encoding} br
+    RewriteCond %{REQUEST_FILENAME}.br -f
+    RewriteRule ^(.*)$ $1.br [L]
+    RewriteCond %{HTTP:Accept-Encoding} gzip
+    RewriteCond %{REQUEST_FILENAME}.gz -f
+    RewriteRule ^(.*)$ $1.gz [L]
+</IfModule>
+`)
+		for _, encoding := range PrecompressedEncodings {
+			for _, ext := range compressibleExtensionList() {
+				fmt.Fprintf(&b, "<FilesMatch \"\\.%s\\%s$\">\n    ForceType %s\n    Header set Content-Encoding %s\n    Header append Vary Accept-Encoding\n</FilesMatch>\n",
+					strings.TrimPrefix(ext, "."), encoding.Extension, compressibleExtensions[ext], encoding.Name)
+			}
+		}
+	}
+	return writeHostingFile(outputDirectory, HtaccessFileName, b.String())
+}
+
+// SaveNginxConf writes an nginx snippet meant to be included inside the server block
+// serving the output directory.
+func SaveNginxConf(config HostingConfig, outputDirectory string) error {
+	var b strings.Builder
+	b.WriteString("# Generated by DSBG. Include inside the server { } block serving the site.\n\n")
+	if config.Precompressed {
+		b.WriteString("gzip_static on;\n# Requires ngx_brotli.\n# brotli_static on;\n\n")
+	}
+	if config.NotFoundPage != "" {
+		fmt.Fprintf(&b, "error_page 404 %s;\n\n", config.NotFoundPage)
+	}
+
+	// add_header directives are not inherited by locations that declare their own,
+	// so the security headers are repeated in each block.
+	securityHeaders := func(indent string) {
+		for _, header := range config.SecurityHeaders {
+			fmt.Fprintf(&b, "%sadd_header %s \"%s\" always;\n", indent, header.Name, header.Value)
+		}
+	}
+	securityHeaders("")
+	b.WriteString("\n")
+
+	for _, redirect := range config.Redirects {
+		fmt.Fprintf(&b, "location ~ \"%s\" {\n    return %d %s;\n}\n", exactPathPattern(redirect.From), redirect.Status, redirect.To)
+	}
+	if len(config.Redirects) > 0 {
+		b.WriteString("\n")
+	}
+
+	// nginx uses the first matching regex location, so fingerprinted assets come first.
+	fmt.Fprintf(&b, "# Fingerprinted assets\nlocation ~* \"%s\" {\n", fingerprintPattern)
+	securityHeaders("    ")
+	fmt.Fprintf(&b, "    add_header Cache-Control \"%s\" always;\n}\n", ImmutableCacheControl)
+	for _, rule := range config.CacheRules {
+		fmt.Fprintf(&b, "# %s\nlocation ~* \"%s\" {\n", rule.Name, extensionPattern(rule))
+		securityHeaders("    ")
+		fmt.Fprintf(&b, "    add_header Cache-Control \"%s\" always;\n}\n", rule.CacheControl)
+	}
+	return writeHostingFile(outputDirectory, NginxConfFileName, b.String())
+}
+
+// writesRedirectsFile reports whether the hosting targets get a _redirects file.
+func writesRedirectsFile(targets []string) bool {
+	return slices.Contains(targets, HostingNetlify) || slices.Contains(targets, HostingCloudflare)
+}
+
+// NeedsRedirectPages reports whether redirects should get meta refresh pages. They are
+// left out when a _redirects file is written, as Netlify does not apply a rule to a path
+// that exists, so the pages would shadow the permanent redirects.
+func (s Settings) NeedsRedirectPages() bool {
+	return !writesRedirectsFile(s.HostingTargets)
+}
+
+// SaveHostingFiles writes the configuration files for the given targets.
+func SaveHostingFiles(config HostingConfig, targets []string, outputDirectory string) error {
+	if writesRedirectsFile(targets) {
+		if err := SaveHeadersFile(config, outputDirectory); err != nil {
+			return err
+		}
+		if err := SaveRedirectsFile(config, outputDirectory); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(targets, HostingApache) {
+		if err := SaveHtaccess(config, outputDirectory); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(targets, HostingNginx) {
+		if err := SaveNginxConf(config, outputDirectory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -111,6 +111,12 @@ func HTMLFile(path string, settings Settings) (Article, []string, error) {
 			article.ExternalLink = val
 		case "canonical_url":
 			article.CanonicalUrl = val
+		case "aliases":
+			article.Aliases = frontmatterStringList(val)
+		case "mirror":
+			if mirror, ok := frontmatterBool(val); ok {
+				article.NoMirror = !mirror
+			}
 		}
 	}
 
@@ -165,8 +171,13 @@ func GenerateHtmlIndex(articles []Article, settings Settings, tmpl *texttemplate
 		return fmt.Errorf("error executing HTML index template: %w", err)
 	}
 
+	content := tp.String()
+	if settings.CSPInMeta() {
+		content = InjectCSPMeta(content, PageCSP(content))
+	}
+
 	filePath := filepath.Join(settings.OutputPath, settings.IndexName)
-	if err := os.WriteFile(filePath, tp.Bytes(), 0644); err != nil {
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
 		return fmt.Errorf("error writing HTML index file to '%s': %w", filePath, err)
 	}
 	return nil
@@ -0,0 +1,341 @@
+package parse
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// hugoConfigFiles are the site configuration files Hugo looks for, in order.
+var hugoConfigFiles = []string{
+	"hugo.toml", "hugo.yaml", "hugo.yml", "hugo.json",
+	"config.toml", "config.yaml", "config.yml", "config.json",
+	"config/_default/hugo.toml", "config/_default/hugo.yaml", "config/_default/hugo.yml", "config/_default/hugo.json",
+	"config/_default/config.toml", "config/_default/config.yaml", "config/_default/config.yml", "config/_default/config.json",
+}
+
+// Hugo shortcodes converted to Markdown.
+var (
+	regexHugoFigure    = regexp.MustCompile(`\{\{[<%]-?\s*figure\s+(.*?)\s*/?-?[>%]\}\}`)
+	regexHugoHighlight = regexp.MustCompile(`(?s)\{\{[<%]-?\s*highlight\s+(\S+)[^}]*[>%]\}\}\n?(.*?)\{\{[<%]-?\s*/highlight\s*-?[>%]\}\}`)
+	regexHugoRef       = regexp.MustCompile(`\{\{[<%]-?\s*(?:rel)?ref\s+"?([^"\s}]+)"?\s*-?[>%]\}\}`)
+	// regexShortcodeAttr matches the name="value" attributes of a shortcode.
+	regexShortcodeAttr = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|'([^']*)'|(\S+))`)
+)
+
+// hugoSource is a content file of a Hugo site.
+type hugoSource struct {
+	relPath string // Relative to the content folder, slash-separated
+	bundle  bool   // index.md of a leaf bundle, whose folder holds its resources
+	fm      map[string]any
+	body    string
+}
+
+// hugoImporter converts the content of a Hugo site.
+type hugoImporter struct {
+	siteImporter
+	permalinks map[string]string // Permalink patterns by section
+	lowercase  bool              // Hugo lowercases URLs unless disablePathToLower is set
+	names      map[string]string // Output paths of articles (without extension), by content path
+}
+
+// refKey normalizes the path given to ref and relref, or of a content file, to look up
+// articles: no leading slash, extension, or trailing /index.
+func refKey(ref string) string {
+	ref = strings.Trim(ref, "/")
+	ref = strings.TrimSuffix(ref, path.Ext(ref))
+	return strings.TrimSuffix(strings.TrimSuffix(ref, "/index"), "/_index")
+}
+
+// convertShortcodes replaces the Hugo shortcodes of an article written at name that have
+// a Markdown equivalent: figure, highlight, ref and relref.
+func (h *hugoImporter) convertShortcodes(body string, name string) string {
+	body = regexHugoHighlight.ReplaceAllStringFunc(body, func(block string) string {
+		m := regexHugoHighlight.FindStringSubmatch(block)
+		return fencedCode(strings.Trim(m[1], `"'`), m[2])
+	})
+	body = regexHugoFigure.ReplaceAllStringFunc(body, func(figure string) string {
+		attrs := map[string]string{}
+		for _, m := range regexShortcodeAttr.FindAllStringSubmatch(regexHugoFigure.FindStringSubmatch(figure)[1], -1) {
+			attrs[m[1]] = m[2] + m[3] + m[4]
+		}
+		alt := attrs["alt"]
+		if alt == "" {
+			alt = attrs["caption"]
+		}
+		image := "![" + alt + "](" + attrs["src"] + ")"
+		if caption := attrs["caption"]; caption != "" && caption != alt {
+			image += "\n*" + caption + "*"
+		}
+		return image
+	})
+	return regexHugoRef.ReplaceAllStringFunc(body, func(ref string) string {
+		target, fragment, _ := strings.Cut(regexHugoRef.FindStringSubmatch(ref)[1], "#")
+		if fragment != "" {
+			fragment = "#" + fragment
+		}
+		key := refKey(target)
+		if target == "" {
+			return fragment
+		}
+		if linked, ok := h.names[key]; ok {
+			return importLink(name, linked+".md") + fragment
+		}
+		// Refs may name a page by its file name alone.
+		for source, linked := range h.names {
+			if path.Base(source) == path.Base(key) {
+				return importLink(name, linked+".md") + fragment
+			}
+		}
+		return ref
+	})
+}
+
+// oldPermalink returns the URL path of a content file on the Hugo site.
+func (h *hugoImporter) oldPermalink(source hugoSource, title string, created string) string {
+	if link := fmString(source.fm, "url"); link != "" {
+		return expandOldPermalink(link, nil)
+	}
+	dir, file := path.Split(refKey(source.relPath))
+	dir = strings.Trim(dir, "/")
+	section, _, _ := strings.Cut(dir, "/")
+	slug := fmString(source.fm, "slug")
+
+	link := ""
+	if pattern, ok := h.permalinks[section]; ok && dir != "" {
+		date, _ := time.Parse(importDateFormat, created)
+		slugOrFilename := file
+		if slug != "" {
+			slugOrFilename = slug
+		}
+		link = expandOldPermalink(pattern, map[string]string{
+			"year":                  date.Format("2006"),
+			"month":                 date.Format("01"),
+			"monthname":             strings.ToLower(date.Format("January")),
+			"day":                   date.Format("02"),
+			"weekday":               fmt.Sprint(int(date.Weekday())),
+			"weekdayname":           strings.ToLower(date.Format("Monday")),
+			"yearday":               fmt.Sprint(date.YearDay()),
+			"section":               section,
+			"sections":              dir,
+			"title":                 importSlug(title),
+			"slug":                  importSlug(cmp.Or(slug, title)),
+			"filename":              file,
+			"contentbasename":       file,
+			"slugorfilename":        slugOrFilename,
+			"slugorcontentbasename": slugOrFilename,
+		})
+	} else {
+		if slug != "" {
+			file = slug
+		}
+		link = expandOldPermalink(path.Join(dir, file)+"/", nil)
+	}
+	if h.lowercase {
+		link = strings.ToLower(link)
+	}
+	return link
+}
+
+// article converts a content file, whose Name is already set, of the Hugo site.
+func (h *hugoImporter) article(source hugoSource, name string) importedArticle {
+	fm := importedFrontmatter{
+		Title:       fmString(source.fm, "title"),
+		Description: fmString(source.fm, "description", "summary"),
+		Created:     fmDate(source.fm, "date", "publishdate", "pubdate", "published"),
+		Updated:     fmDate(source.fm, "lastmod", "modified", "updated"),
+		CoverImage:  fmImage(source.fm),
+	}
+	if fm.Title == "" {
+		fm.Title = strings.ReplaceAll(path.Base(name), "-", " ")
+	}
+	if fm.Updated == fm.Created {
+		fm.Updated = ""
+	}
+	if strings.Contains(source.relPath, "/") {
+		for _, tag := range append(fmList(source.fm["categories"]), fmList(source.fm["tags"])...) {
+			fm.Tags = appendTag(fm.Tags, tag)
+		}
+	} else {
+		// Files at the root of the content folder are standalone pages.
+		fm.Tags = []string{"PAGE"}
+	}
+
+	if alias := h.oldPermalink(source, fm.Title, fm.Created); alias != "" {
+		fm.Aliases = append(fm.Aliases, alias)
+	}
+	for _, alias := range fmList(source.fm["aliases"]) {
+		if strings.Contains(alias, "://") {
+			continue
+		}
+		if !strings.HasPrefix(alias, "/") {
+			// Relative aliases are relative to the page's section.
+			alias = path.Join(path.Dir(refKey(source.relPath)), alias)
+		}
+		if alias = expandOldPermalink(alias, nil); alias != "" && !slices.Contains(fm.Aliases, alias) {
+			fm.Aliases = append(fm.Aliases, alias)
+		}
+	}
+
+	bundle := ""
+	if source.bundle {
+		bundle = path.Base(path.Dir(source.relPath))
+	}
+	if fm.CoverImage != "" {
+		if link, ok := h.localLink(fm.CoverImage, name, bundle); ok {
+			fm.CoverImage = link
+		}
+	}
+	body := h.localLinks(h.convertShortcodes(source.body, name), name, bundle)
+	return importedArticle{Name: name, Frontmatter: fm, Body: body}
+}
+
+// ImportHugo converts the Markdown content of a Hugo site into Markdown files with DSBG
+// frontmatter in opts.OutputPath, keeping the folders of the content directory, and
+// copies the static folder and the resources of the content there. Leaf bundles
+// (folder/index.md) become folder.md with their resources in folder/. Files at the root
+// of the content folder are tagged PAGE, section listings (_index.md) and drafts are
+// skipped, and the old URLs, from the permalinks configuration, are kept as aliases.
+func ImportHugo(siteDir string, opts ImportOptions) (ImportReport, error) {
+	var report ImportReport
+	config := map[string]any{}
+	for _, name := range hugoConfigFiles {
+		if _, err := os.Stat(filepath.Join(siteDir, name)); err == nil {
+			var err error
+			if config, err = decodeConfig(filepath.Join(siteDir, name)); err != nil {
+				return report, err
+			}
+			break
+		}
+	}
+
+	h := &hugoImporter{
+		siteImporter: newSiteImporter(fmString(config, "baseurl"), opts, &report),
+		permalinks:   map[string]string{},
+		names:        map[string]string{},
+	}
+	disablePathToLower, _ := frontmatterBool(config["disablepathtolower"])
+	h.lowercase = !disablePathToLower
+	if permalinks, ok := config["permalinks"].(map[string]any); ok {
+		// Hugo 0.115 moved section patterns to permalinks.page.
+		if page, ok := permalinks["page"].(map[string]any); ok {
+			permalinks = page
+		}
+		for section, pattern := range permalinks {
+			if pattern, ok := pattern.(string); ok {
+				h.permalinks[section] = pattern
+			}
+		}
+	}
+
+	staticDirs := fmList(config["staticdir"])
+	if len(staticDirs) == 0 {
+		staticDirs = []string{"static"}
+	}
+	for _, dir := range staticDirs {
+		staticDir := filepath.Join(siteDir, dir)
+		if _, err := os.Stat(staticDir); err != nil {
+			continue
+		}
+		err := filepath.WalkDir(staticDir, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			relPath, err := filepath.Rel(staticDir, filePath)
+			if err != nil {
+				return err
+			}
+			return h.addStatic(filePath, filepath.ToSlash(relPath))
+		})
+		if err != nil {
+			return report, fmt.Errorf("failed to copy static files from '%s': %w", staticDir, err)
+		}
+	}
+
+	contentDir := filepath.Join(siteDir, cmp.Or(fmString(config, "contentdir"), "content"))
+	if _, err := os.Stat(contentDir); err != nil {
+		return report, fmt.Errorf("content directory '%s' not found", contentDir)
+	}
+	var sources []hugoSource
+	err := filepath.WalkDir(contentDir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(contentDir, filePath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		base := d.Name()
+		if !isMarkdownFile(base) {
+			if strings.HasPrefix(base, ".") {
+				return nil
+			}
+			// Page resources keep their place next to the content.
+			_, err := h.files.copy(filePath, relPath)
+			return err
+		}
+		stem := strings.TrimSuffix(base, filepath.Ext(base))
+		if stem == "_index" {
+			return nil
+		}
+
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", filePath, err)
+		}
+		fm, body, _, err := splitFrontmatter(content)
+		if err != nil {
+			return fmt.Errorf("failed to parse frontmatter of '%s': %w", filePath, err)
+		}
+		if fm == nil {
+			fm = map[string]any{}
+		}
+		if draft, _ := frontmatterBool(fm["draft"]); draft {
+			report.Skipped++
+			return nil
+		}
+		if headless, _ := frontmatterBool(fm["headless"]); headless {
+			return nil
+		}
+		sources = append(sources, hugoSource{relPath: relPath, bundle: stem == "index" && strings.Contains(relPath, "/"), fm: fm, body: body})
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	articles := make([]importedArticle, len(sources))
+	for i, source := range sources {
+		name := refKey(source.relPath)
+		if slug := fmString(source.fm, "slug"); slug != "" {
+			name = path.Join(path.Dir(name), importSlug(slug))
+		}
+		articles[i].Name = name
+	}
+	assignImportNames(articles)
+	for i, source := range sources {
+		h.names[refKey(source.relPath)] = articles[i].Name
+	}
+
+	for i, source := range sources {
+		articles[i] = h.article(source, articles[i].Name)
+		reportShortcodes(articles[i])
+		if slices.Contains(articles[i].Frontmatter.Tags, "PAGE") {
+			report.Pages++
+		} else {
+			report.Posts++
+		}
+	}
+	if err := writeImportedArticles(articles, opts); err != nil {
+		return report, err
+	}
+	return report, nil
+}
@@ -0,0 +1,495 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ImportMediaDirName is the folder, inside the import's output directory, receiving the
+// media files referenced by imported articles.
+const ImportMediaDirName = "media"
+
+// ImportOptions configures the importers of "dsbg import".
+type ImportOptions struct {
+	OutputPath string // Folder the Markdown files are written to
+	MediaPath  string // Optional folder holding the media files of the imported site
+	Overwrite  bool   // Replace existing files instead of failing
+}
+
+// ImportReport counts what an import converted and what it left out.
+type ImportReport struct {
+	Posts   int
+	Pages   int
+	Files   int // Media and other files copied
+	Skipped int // Drafts and other unpublished entries
+}
+
+// importedFrontmatter is the DSBG frontmatter of an imported article, in writing order.
+type importedFrontmatter struct {
+	Title       string   `yaml:"title"`
+	Description string   `yaml:"description,omitempty"`
+	Created     string   `yaml:"created,omitempty"`
+	Updated     string   `yaml:"updated,omitempty"`
+	Tags        []string `yaml:"tags,flow,omitempty"`
+	CoverImage  string   `yaml:"cover_image,omitempty"`
+	Aliases     []string `yaml:"aliases,omitempty"`
+}
+
+// importedArticle is an article converted by an importer, before it is written.
+type importedArticle struct {
+	Name        string // File path without extension, relative to the output directory
+	Frontmatter importedFrontmatter
+	Body        string   // Markdown
+	literal     []string // Parts of Body kept as written, such as Liquid raw blocks
+}
+
+// importDateFormat is the format of the dates written to imported frontmatter.
+const importDateFormat = "2006-01-02 15:04:05"
+
+// importSlug turns a title into a file name: lowercase letters and digits separated by
+// single hyphens.
+func importSlug(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+// appendTag adds tag to tags unless it is empty or already present, ignoring case.
+func appendTag(tags []string, tag string) []string {
+	tag = strings.TrimSpace(tag)
+	if tag == "" || slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+		return tags
+	}
+	return append(tags, tag)
+}
+
+// regexShortcode matches WordPress and Hugo shortcodes and Liquid tags: [name attr="..."],
+// [/name], {{< name >}}, {{% name %}}, {% name %} and {{ variable }}.
+var regexShortcode = regexp.MustCompile(`\[(/?)([a-z_][a-z0-9_-]*)(\s[^\]\n]*)?\]|\{\{[<%]-?\s*/?([\w/.-]+)[^}]*[>%]\}\}|\{%-?\s*(\w+)|\{\{-?\s*([\w.]+)[^}]*\}\}`)
+
+// unconvertedShortcodes returns the names of the shortcodes and Liquid tags left in
+// content. Bracketed names only count as shortcodes when they have attributes or a
+// closing tag, so Markdown link references like [1] are not reported.
+func unconvertedShortcodes(content string) []string {
+	var names []string
+	for _, m := range regexShortcode.FindAllStringSubmatch(content, -1) {
+		name := m[4] + m[5] + m[6]
+		if m[2] != "" && (m[1] == "/" || strings.Contains(m[3], "=") || strings.Contains(content, "[/"+m[2]+"]")) {
+			name = m[2]
+		}
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// shortcodes returns the unconverted shortcodes of the body of an imported article,
+// leaving out its literal parts, where braces and brackets are meant as written.
+func (a importedArticle) shortcodes() []string {
+	body := a.Body
+	for _, literal := range a.literal {
+		body = strings.Replace(body, literal, "", 1)
+	}
+	return unconvertedShortcodes(body)
+}
+
+// reportShortcodes warns about the shortcodes left in the body of an imported article.
+func reportShortcodes(article importedArticle) {
+	if shortcodes := article.shortcodes(); len(shortcodes) > 0 {
+		log.Printf("Warning: '%s' contains unconverted shortcodes: %s\n", article.Name+".md", strings.Join(shortcodes, ", "))
+	}
+}
+
+// assignImportNames makes the Names of articles unique, ignoring case, by appending -2,
+// -3... to repeated ones.
+func assignImportNames(articles []importedArticle) {
+	used := map[string]bool{}
+	for i := range articles {
+		name := articles[i].Name
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s-%d", articles[i].Name, n)
+		}
+		used[strings.ToLower(name)] = true
+		articles[i].Name = name
+	}
+}
+
+// writeImportedArticles writes each article as <Name>.md in the output directory, with
+// its frontmatter. Unless opts.Overwrite is set, nothing is written if a file exists.
+func writeImportedArticles(articles []importedArticle, opts ImportOptions) error {
+	assignImportNames(articles)
+	if !opts.Overwrite {
+		for _, article := range articles {
+			filePath := filepath.Join(opts.OutputPath, filepath.FromSlash(article.Name)+".md")
+			if _, err := os.Stat(filePath); err == nil {
+				return fmt.Errorf("'%s' already exists; use -overwrite to replace it", filePath)
+			}
+		}
+	}
+	for _, article := range articles {
+		filePath := filepath.Join(opts.OutputPath, filepath.FromSlash(article.Name)+".md")
+		var content bytes.Buffer
+		content.WriteString("---\n")
+		encoder := yaml.NewEncoder(&content)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(article.Frontmatter); err != nil {
+			return fmt.Errorf("failed to encode frontmatter of '%s': %w", filePath, err)
+		}
+		encoder.Close()
+		content.WriteString("---\n\n")
+		content.WriteString(strings.TrimSpace(article.Body) + "\n")
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for '%s': %w", filePath, err)
+		}
+		if err := os.WriteFile(filePath, content.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error writing '%s': %w", filePath, err)
+		}
+	}
+	return nil
+}
+
+// importFiles copies files into the output directory, each once, and counts them in
+// the report.
+type importFiles struct {
+	opts   ImportOptions
+	report *ImportReport
+	copied map[string]bool
+}
+
+func newImportFiles(opts ImportOptions, report *ImportReport) *importFiles {
+	return &importFiles{opts: opts, report: report, copied: map[string]bool{}}
+}
+
+// copy copies the file at src to relPath (slash-separated) in the output directory and
+// returns its link relative to the output directory. Existing files are only replaced
+// with opts.Overwrite.
+func (f *importFiles) copy(src string, relPath string) (string, error) {
+	relPath = path.Clean("/" + relPath)[1:]
+	if !f.copied[relPath] {
+		dest := filepath.Join(f.opts.OutputPath, filepath.FromSlash(relPath))
+		if _, err := os.Stat(dest); err != nil || f.opts.Overwrite {
+			if err := copyFileTo(src, dest); err != nil {
+				return "", fmt.Errorf("failed to copy '%s': %w", src, err)
+			}
+		}
+		f.copied[relPath] = true
+		f.report.Files++
+	}
+	return EncodePathSegments(relPath), nil
+}
+
+// splitFrontmatter separates Markdown source into its decoded YAML (---), TOML (+++) or
+// JSON frontmatter, with lowercased keys, and its body. It reports false if the source
+// has no frontmatter.
+func splitFrontmatter(source []byte) (map[string]any, string, bool, error) {
+	source = bytes.TrimPrefix(source, []byte("\ufeff"))
+	raw := map[string]any{}
+	body := source
+	firstLine, rest, _ := bytes.Cut(source, []byte("\n"))
+	switch delimiter := string(bytes.TrimSpace(firstLine)); {
+	case delimiter == "---" || delimiter == "+++":
+		var block []byte
+		closed := false
+		for len(rest) > 0 && !closed {
+			var line []byte
+			line, rest, _ = bytes.Cut(rest, []byte("\n"))
+			if closed = string(bytes.TrimSpace(line)) == delimiter; !closed {
+				block = append(append(block, line...), '\n')
+			}
+		}
+		if !closed {
+			return nil, string(source), false, nil
+		}
+		var err error
+		if delimiter == "---" {
+			err = yaml.Unmarshal(block, &raw)
+		} else {
+			err = toml.Unmarshal(block, &raw)
+		}
+		if err != nil {
+			return nil, "", false, err
+		}
+		body = rest
+	case strings.HasPrefix(delimiter, "{"):
+		decoder := json.NewDecoder(bytes.NewReader(source))
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, "", false, err
+		}
+		body = source[decoder.InputOffset():]
+	default:
+		return nil, string(source), false, nil
+	}
+
+	fm := make(map[string]any, len(raw))
+	for key, value := range raw {
+		fm[strings.ToLower(key)] = value
+	}
+	return fm, string(body), true, nil
+}
+
+// fmString returns the first of the frontmatter keys holding a non-empty string.
+func fmString(fm map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := fm[key].(string); ok && strings.TrimSpace(s) != "" {
+			return strings.TrimSpace(s)
+		}
+	}
+	return ""
+}
+
+// fmDate returns the first of the frontmatter keys holding a date, in the frontmatter
+// format of imported articles, or "".
+func fmDate(fm map[string]any, keys ...string) string {
+	for _, key := range keys {
+		switch v := fm[key].(type) {
+		case time.Time:
+			return v.UTC().Format(importDateFormat)
+		case string:
+			v = strings.TrimSpace(v)
+			for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05 -0700", "2006-01-02 15:04:05 -07:00", "2006-01-02 15:04:05", "2006-01-02 15:04 -0700", "2006-01-02 15:04", "2006-01-02"} {
+				if t, err := time.Parse(layout, v); err == nil {
+					return t.UTC().Format(importDateFormat)
+				}
+			}
+			if t, err := DateTimeFromString(v); err == nil {
+				return t.Format(importDateFormat)
+			}
+		}
+	}
+	return ""
+}
+
+// fmList returns the items of a frontmatter list. Strings are split on commas, or on
+// whitespace if they have none, as Jekyll does for categories and tags.
+func fmList(value any) []string {
+	switch v := value.(type) {
+	case string:
+		if strings.Contains(v, ",") {
+			return frontmatterStringList(v)
+		}
+		return strings.Fields(v)
+	default:
+		return frontmatterStringList(v)
+	}
+}
+
+// fmImage returns the image of the common theme conventions: image (a path or a map with
+// a path), images (the first), cover.image, or feature_image.
+func fmImage(fm map[string]any) string {
+	for _, key := range []string{"image", "cover", "images", "feature_image", "featured_image", "thumbnail"} {
+		switch v := fm[key].(type) {
+		case string:
+			if key != "cover" && strings.TrimSpace(v) != "" {
+				return strings.TrimSpace(v)
+			}
+		case []any:
+			if len(v) > 0 {
+				if s, ok := v[0].(string); ok && s != "" {
+					return s
+				}
+			}
+		case map[string]any:
+			for _, field := range []string{"path", "image", "src", "url", "feature"} {
+				if s, ok := v[field].(string); ok && s != "" {
+					return s
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// regexPermalinkToken matches the placeholders of Jekyll and Hugo permalink patterns.
+var regexPermalinkToken = regexp.MustCompile(`:\w+`)
+
+// expandOldPermalink returns the URL path of an article on the old site, from a Jekyll or
+// Hugo permalink pattern and the values of its placeholders. Unknown placeholders are
+// kept, and "" is returned for the site root.
+func expandOldPermalink(pattern string, values map[string]string) string {
+	link := regexPermalinkToken.ReplaceAllStringFunc(pattern, func(token string) string {
+		if value, ok := values[token[1:]]; ok {
+			return value
+		}
+		return token
+	})
+	trailing := strings.HasSuffix(link, "/")
+	link = path.Clean("/" + link)
+	if link == "/" {
+		return ""
+	}
+	if trailing {
+		link += "/"
+	}
+	return link
+}
+
+// importLink returns the link from the article written at name to the output path target,
+// both relative to the output directory.
+func importLink(name string, target string) string {
+	link, err := filepath.Rel(filepath.FromSlash(path.Dir(name)), filepath.FromSlash(target))
+	if err != nil {
+		return target
+	}
+	return EncodePathSegments(filepath.ToSlash(link))
+}
+
+// siteImporter holds what the Jekyll and Hugo importers share: the static files copied
+// from the old site and the address it was served at, to rewrite the links of articles.
+type siteImporter struct {
+	opts     ImportOptions
+	report   *ImportReport
+	files    *importFiles
+	siteHost string            // Host of the old site, like "example.com"
+	basePath string            // Path the old site was served under, like "/blog", or ""
+	static   map[string]string // Output paths of copied files, by the path they were served at
+}
+
+func newSiteImporter(baseURL string, opts ImportOptions, report *ImportReport) siteImporter {
+	s := siteImporter{
+		opts:   opts,
+		report: report,
+		files:  newImportFiles(opts, report),
+		static: map[string]string{},
+	}
+	if u, err := url.Parse(strings.TrimSpace(baseURL)); err == nil {
+		s.siteHost = u.Host
+		s.basePath = strings.TrimSuffix(u.Path, "/")
+	}
+	return s
+}
+
+// addStatic copies the file at src to relPath in the output directory, recording it as
+// served at /relPath on the old site.
+func (s *siteImporter) addStatic(src string, relPath string) error {
+	if _, err := s.files.copy(src, relPath); err != nil {
+		return err
+	}
+	s.static["/"+relPath] = relPath
+	return nil
+}
+
+// regexImportDestination matches the destinations of Markdown links and images, and the
+// src, href and poster attributes of inline HTML.
+var regexImportDestination = regexp.MustCompile(`(\]\(<?|\]:[ \t]*<?|(?:src|href|poster)=["'])([^\s)>"']+)`)
+
+// localLinks rewrites the links of an article body written at name: links to static files
+// of the old site point to their copies, and other absolute links to the old site become
+// root-relative, so they follow the aliases of the imported articles. With a bundle
+// folder, relative links to the files copied from it are prefixed with it.
+func (s *siteImporter) localLinks(body string, name string, bundle string) string {
+	return regexImportDestination.ReplaceAllStringFunc(body, func(match string) string {
+		m := regexImportDestination.FindStringSubmatch(match)
+		if link, ok := s.localLink(m[2], name, bundle); ok {
+			return m[1] + link
+		}
+		return match
+	})
+}
+
+// localLink returns the rewritten destination of a link, as described in localLinks.
+func (s *siteImporter) localLink(destination string, name string, bundle string) (string, bool) {
+	u, err := url.Parse(destination)
+	if err != nil || u.Opaque != "" {
+		return "", false
+	}
+	suffix := ""
+	if u.RawQuery != "" {
+		suffix = "?" + u.RawQuery
+	}
+	suffix += fragmentSuffix(u)
+
+	sitePath := u.Path
+	switch {
+	case u.Host != "":
+		if s.siteHost == "" || !strings.EqualFold(u.Host, s.siteHost) {
+			return "", false
+		}
+	case !strings.HasPrefix(sitePath, "/"):
+		relPath := path.Join(path.Dir(name), bundle, sitePath)
+		if bundle == "" || sitePath == "" || !s.files.copied[relPath] {
+			return "", false
+		}
+		return EncodePathSegments(path.Join(bundle, sitePath)) + suffix, true
+	}
+
+	if rest, ok := strings.CutPrefix(sitePath, s.basePath); ok && (rest == "" || rest[0] == '/') {
+		sitePath = rest
+	}
+	if target, ok := s.static[sitePath]; ok {
+		return importLink(name, target) + suffix, true
+	}
+	if u.Host == "" {
+		return "", false
+	}
+	if sitePath == "" {
+		sitePath = "/"
+	}
+	return sitePath + suffix, true
+}
+
+// fencedCode returns code as a fenced Markdown code block.
+func fencedCode(lang string, code string) string {
+	return "```" + lang + "\n" + strings.Trim(code, "\n") + "\n```"
+}
+
+// isMarkdownFile reports whether a file has one of the extensions Jekyll and Hugo use for
+// Markdown.
+func isMarkdownFile(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".md", ".markdown", ".mkd", ".mkdn", ".mdown":
+		return true
+	}
+	return false
+}
+
+// decodeConfig decodes a YAML, TOML or JSON site configuration file, with lowercased
+// top-level keys.
+func decodeConfig(filePath string) (map[string]any, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".toml":
+		err = toml.Unmarshal(content, &raw)
+	case ".json":
+		err = json.Unmarshal(content, &raw)
+	default:
+		err = yaml.Unmarshal(content, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", filePath, err)
+	}
+	config := make(map[string]any, len(raw))
+	for key, value := range raw {
+		config[strings.ToLower(key)] = value
+	}
+	return config, nil
+}
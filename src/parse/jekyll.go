@@ -0,0 +1,344 @@
+package parse
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/k3a/html2text"
+)
+
+// regexJekyllPostName splits the file name of a Jekyll post into its date and title.
+var regexJekyllPostName = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})-(.+)$`)
+
+// jekyllPermalinkStyles are the built-in permalink styles of Jekyll.
+var jekyllPermalinkStyles = map[string]string{
+	"date":    "/:categories/:year/:month/:day/:title:output_ext",
+	"pretty":  "/:categories/:year/:month/:day/:title/",
+	"ordinal": "/:categories/:year/:y_day/:title:output_ext",
+	"none":    "/:categories/:title:output_ext",
+}
+
+// Liquid tags converted to Markdown.
+var (
+	regexLiquidHighlight = regexp.MustCompile(`(?s)\{%-?\s*highlight\s+(\S+)[^%]*-?%\}\n?(.*?)\{%-?\s*endhighlight\s*-?%\}`)
+	regexLiquidRaw       = regexp.MustCompile(`(?s)\{%-?\s*raw\s*-?%\}(.*?)\{%-?\s*endraw\s*-?%\}`)
+	regexLiquidRawTag    = regexp.MustCompile(`\{%-?\s*(?:end)?raw\s*-?%\}`)
+	regexLiquidPostURL   = regexp.MustCompile(`\{%-?\s*post_url\s+(\S+?)\s*-?%\}`)
+	regexLiquidLink      = regexp.MustCompile(`\{%-?\s*link\s+(\S+?)\s*-?%\}`)
+	regexLiquidSiteURL   = regexp.MustCompile(`\{\{-?\s*site\.(?:url|baseurl)\s*-?\}\}`)
+	regexLiquidURLFilter = regexp.MustCompile(`\{\{-?\s*["']([^"']*)["']\s*\|\s*(?:relative_url|absolute_url)\s*-?\}\}`)
+)
+
+// jekyllSource is a post or page found in a Jekyll site.
+type jekyllSource struct {
+	relPath string // Relative to the site, slash-separated
+	post    bool
+	fm      map[string]any
+	body    string
+}
+
+// jekyllImporter converts the posts and pages of a Jekyll site.
+type jekyllImporter struct {
+	siteImporter
+	permalink string
+	names     map[string]string // Output paths of articles (without extension), by source path
+}
+
+// convertLiquid replaces the Liquid tags of a Jekyll article written at name that have a
+// Markdown equivalent: highlight blocks, raw, post_url, link, and site URLs. The content
+// of raw blocks is kept as written, and returned as well.
+func (j *jekyllImporter) convertLiquid(body string, name string) (string, []string) {
+	// Raw blocks are set aside while the other tags are converted, as they may sit inside
+	// highlight blocks.
+	var literal []string
+	body = regexLiquidRaw.ReplaceAllStringFunc(body, func(block string) string {
+		literal = append(literal, regexLiquidRaw.FindStringSubmatch(block)[1])
+		return fmt.Sprintf("\x00%d\x00", len(literal)-1)
+	})
+	body = regexLiquidHighlight.ReplaceAllStringFunc(body, func(block string) string {
+		m := regexLiquidHighlight.FindStringSubmatch(block)
+		return fencedCode(m[1], m[2])
+	})
+	body = regexLiquidRawTag.ReplaceAllString(body, "")
+	body = regexLiquidSiteURL.ReplaceAllString(body, "")
+	body = regexLiquidURLFilter.ReplaceAllString(body, "$1")
+	body = regexLiquidPostURL.ReplaceAllStringFunc(body, func(tag string) string {
+		post := regexLiquidPostURL.FindStringSubmatch(tag)[1]
+		for source, target := range j.names {
+			if strings.HasSuffix(strings.TrimSuffix(source, path.Ext(source)), "_posts/"+post) {
+				return importLink(name, target+".md")
+			}
+		}
+		return tag
+	})
+	body = regexLiquidLink.ReplaceAllStringFunc(body, func(tag string) string {
+		linked := strings.TrimPrefix(regexLiquidLink.FindStringSubmatch(tag)[1], "/")
+		if target, ok := j.names[linked]; ok {
+			return importLink(name, target+".md")
+		}
+		return "/" + linked
+	})
+	for i, content := range literal {
+		body = strings.Replace(body, fmt.Sprintf("\x00%d\x00", i), content, 1)
+	}
+	return body, literal
+}
+
+// oldPermalink returns the URL path of a post or page on the Jekyll site.
+func (j *jekyllImporter) oldPermalink(source jekyllSource, categories []string, created string) string {
+	pattern := fmString(source.fm, "permalink")
+	stem := strings.TrimSuffix(path.Base(source.relPath), path.Ext(source.relPath))
+	if !source.post {
+		if pattern != "" {
+			return expandOldPermalink(pattern, nil)
+		}
+		if strings.HasSuffix(j.permalink, "/") {
+			return expandOldPermalink(strings.TrimSuffix(source.relPath, path.Ext(source.relPath))+"/", nil)
+		}
+		return expandOldPermalink(strings.TrimSuffix(source.relPath, path.Ext(source.relPath))+".html", nil)
+	}
+	if pattern == "" {
+		pattern = j.permalink
+	}
+
+	title := stem
+	if m := regexJekyllPostName.FindStringSubmatch(stem); m != nil {
+		title = m[4]
+	}
+	if slug := fmString(source.fm, "slug"); slug != "" {
+		title = slug
+	}
+	date, _ := time.Parse(importDateFormat, created)
+	var categoryPath []string
+	for _, category := range categories {
+		categoryPath = append(categoryPath, strings.ToLower(importSlug(category)))
+	}
+	return expandOldPermalink(pattern, map[string]string{
+		"year":       date.Format("2006"),
+		"short_year": date.Format("06"),
+		"month":      date.Format("01"),
+		"i_month":    date.Format("1"),
+		"day":        date.Format("02"),
+		"i_day":      date.Format("2"),
+		"y_day":      fmt.Sprintf("%03d", date.YearDay()),
+		"hour":       date.Format("15"),
+		"minute":     date.Format("04"),
+		"second":     date.Format("05"),
+		"title":      title,
+		"slug":       importSlug(title),
+		"categories": strings.Join(categoryPath, "/"),
+		"output_ext": ".html",
+	})
+}
+
+// article converts a post or page, whose Name is already set, of the Jekyll site.
+func (j *jekyllImporter) article(source jekyllSource, name string) importedArticle {
+	fm := importedFrontmatter{
+		Title:       fmString(source.fm, "title"),
+		Description: fmString(source.fm, "description"),
+		Created:     fmDate(source.fm, "date"),
+		Updated:     fmDate(source.fm, "last_modified_at", "lastmod", "updated", "modified"),
+		CoverImage:  fmImage(source.fm),
+	}
+	if fm.Description == "" {
+		fm.Description = strings.Join(strings.Fields(html2text.HTML2Text(fmString(source.fm, "excerpt"))), " ")
+	}
+
+	stem := strings.TrimSuffix(path.Base(source.relPath), path.Ext(source.relPath))
+	var categories []string
+	if source.post {
+		if m := regexJekyllPostName.FindStringSubmatch(stem); m != nil {
+			if date, err := DateTimeFromString(m[1] + "-" + m[2] + "-" + m[3]); err == nil && fm.Created == "" {
+				fm.Created = date.Format(importDateFormat)
+			}
+			stem = m[4]
+		}
+		// Folders above _posts are categories in Jekyll.
+		if before, _, ok := strings.Cut(source.relPath, "_posts/"); ok && before != "" {
+			categories = strings.Split(strings.Trim(before, "/"), "/")
+		}
+		categories = append(categories, fmList(source.fm["categories"])...)
+		categories = append(categories, fmList(source.fm["category"])...)
+		for _, tag := range append(slices.Clone(categories), fmList(source.fm["tags"])...) {
+			fm.Tags = appendTag(fm.Tags, tag)
+		}
+	} else {
+		fm.Tags = []string{"PAGE"}
+	}
+	if fm.Title == "" {
+		fm.Title = strings.ReplaceAll(strings.ReplaceAll(stem, "-", " "), "_", " ")
+	}
+	if fm.Updated == fm.Created {
+		fm.Updated = ""
+	}
+
+	if alias := j.oldPermalink(source, categories, fm.Created); alias != "" {
+		fm.Aliases = append(fm.Aliases, alias)
+	}
+	for _, alias := range fmList(source.fm["redirect_from"]) {
+		if alias = expandOldPermalink(alias, nil); alias != "" && !slices.Contains(fm.Aliases, alias) {
+			fm.Aliases = append(fm.Aliases, alias)
+		}
+	}
+
+	if fm.CoverImage != "" {
+		// Themes take image paths relative to the site root.
+		cover := regexLiquidURLFilter.ReplaceAllString(regexLiquidSiteURL.ReplaceAllString(fm.CoverImage, ""), "$1")
+		if !strings.Contains(cover, "://") && !strings.HasPrefix(cover, "/") {
+			cover = "/" + cover
+		}
+		if link, ok := j.localLink(cover, name, ""); ok {
+			fm.CoverImage = link
+		}
+	}
+	body, literal := j.convertLiquid(source.body, name)
+	return importedArticle{Name: name, Frontmatter: fm, Body: j.localLinks(body, name, ""), literal: literal}
+}
+
+// ImportJekyll converts the posts (from _posts folders) and Markdown pages of a Jekyll
+// site into Markdown files with DSBG frontmatter in opts.OutputPath, and copies its static
+// files there. Posts keep their YYYY-MM-DD-title names, from which DSBG takes the date,
+// and folders above _posts are kept, becoming tags like Jekyll's categories. Pages are
+// tagged PAGE. Drafts and unpublished posts are skipped. The old URLs, computed from the
+// permalink setting of _config.yml, are kept as aliases.
+func ImportJekyll(siteDir string, opts ImportOptions) (ImportReport, error) {
+	var report ImportReport
+	config := map[string]any{}
+	if _, err := os.Stat(filepath.Join(siteDir, "_config.yml")); err == nil {
+		var err error
+		if config, err = decodeConfig(filepath.Join(siteDir, "_config.yml")); err != nil {
+			return report, err
+		}
+	}
+	baseURL := fmString(config, "url") + fmString(config, "baseurl")
+	j := &jekyllImporter{
+		siteImporter: newSiteImporter(baseURL, opts, &report),
+		permalink:    jekyllPermalinkStyles["date"],
+		names:        map[string]string{},
+	}
+	if permalink := fmString(config, "permalink"); permalink != "" {
+		j.permalink = permalink
+		if style, ok := jekyllPermalinkStyles[permalink]; ok {
+			j.permalink = style
+		}
+	}
+	excluded := fmList(config["exclude"])
+	outputPath, _ := filepath.Abs(opts.OutputPath)
+
+	var sources []jekyllSource
+	err := filepath.WalkDir(siteDir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(siteDir, filePath)
+		if err != nil || relPath == "." {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		base := d.Name()
+		if d.IsDir() {
+			absPath, _ := filepath.Abs(filePath)
+			if absPath == outputPath || slices.Contains(excluded, relPath) || slices.Contains(excluded, relPath+"/") ||
+				base == "node_modules" || base == "vendor" || strings.HasPrefix(base, ".") ||
+				(strings.HasPrefix(base, "_") && base != "_posts" && base != "_drafts") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_") || slices.Contains(excluded, relPath) {
+			return nil
+		}
+		inPosts := strings.Contains("/"+relPath, "/_posts/")
+		if strings.Contains("/"+relPath, "/_drafts/") {
+			if isMarkdownFile(base) {
+				report.Skipped++
+			}
+			return nil
+		}
+
+		if isMarkdownFile(base) {
+			source, err := os.ReadFile(filePath)
+			if err != nil {
+				return fmt.Errorf("failed to read '%s': %w", filePath, err)
+			}
+			fm, body, ok, err := splitFrontmatter(source)
+			if err != nil {
+				return fmt.Errorf("failed to parse frontmatter of '%s': %w", filePath, err)
+			}
+			stem := strings.TrimSuffix(base, filepath.Ext(base))
+			switch {
+			case !ok && !inPosts:
+				// Jekyll copies Markdown files without frontmatter as they are.
+				return nil
+			case !inPosts && (stem == "index" || stem == "404"):
+				return nil
+			}
+			if published, ok := frontmatterBool(fm["published"]); ok && !published {
+				report.Skipped++
+				return nil
+			}
+			sources = append(sources, jekyllSource{relPath: relPath, post: inPosts, fm: fm, body: body})
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(base)) {
+		case ".html", ".htm", ".xml", ".liquid", ".scss", ".sass", ".yml", ".yaml", ".gemspec":
+			if strings.HasSuffix(strings.ToLower(base), ".html") {
+				if source, err := os.ReadFile(filePath); err == nil {
+					if _, _, ok, _ := splitFrontmatter(source); ok && !inPosts && !strings.HasPrefix(base, "index.") && !strings.HasPrefix(base, "404.") {
+						log.Printf("Warning: Skipping '%s': HTML pages are not converted\n", relPath)
+					}
+				}
+			}
+			return nil
+		}
+		if inPosts || slices.Contains([]string{"Gemfile", "Gemfile.lock", "Rakefile", "CNAME"}, base) {
+			return nil
+		}
+		return j.addStatic(filePath, relPath)
+	})
+	if err != nil {
+		return report, err
+	}
+
+	articles := make([]importedArticle, len(sources))
+	for i, source := range sources {
+		name := strings.TrimSuffix(source.relPath, path.Ext(source.relPath))
+		if source.post {
+			before, after, _ := strings.Cut(name, "_posts/")
+			name = path.Join(before, after)
+			if slug := fmString(source.fm, "slug"); slug != "" {
+				if m := regexJekyllPostName.FindStringSubmatch(path.Base(name)); m != nil {
+					name = path.Join(path.Dir(name), m[1]+"-"+m[2]+"-"+m[3]+"-"+importSlug(slug))
+				}
+			}
+		}
+		articles[i].Name = name
+	}
+	assignImportNames(articles)
+	for i, source := range sources {
+		j.names[source.relPath] = articles[i].Name
+	}
+
+	for i, source := range sources {
+		articles[i] = j.article(source, articles[i].Name)
+		reportShortcodes(articles[i])
+		if source.post {
+			report.Posts++
+		} else {
+			report.Pages++
+		}
+	}
+	if err := writeImportedArticles(articles, opts); err != nil {
+		return report, err
+	}
+	return report, nil
+}
@@ -0,0 +1,53 @@
+package parse
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestJekyllRawBlocks(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		want       string
+		shortcodes []string
+	}{
+		{
+			"raw block",
+			"Use {% raw %}{{ page.title }}{% endraw %} in layouts.",
+			"Use {{ page.title }} in layouts.",
+			nil,
+		},
+		{
+			"tags inside raw are kept",
+			"{% raw %}{{ site.url }} and {% include note.html %}{% endraw %}",
+			"{{ site.url }} and {% include note.html %}",
+			nil,
+		},
+		{
+			"raw inside highlight",
+			"{% highlight liquid %}{% raw %}{{ x }}{% endraw %}{% endhighlight %}",
+			"```liquid\n{{ x }}\n```",
+			nil,
+		},
+		{
+			"shortcodes outside raw are reported",
+			"{% raw %}{{ x }}{% endraw %} then {% include note.html %} and {{ page.title }}",
+			"{{ x }} then {% include note.html %} and {{ page.title }}",
+			[]string{"include", "page.title"},
+		},
+	}
+	j := &jekyllImporter{names: map[string]string{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, literal := j.convertLiquid(tt.body, "posts/a")
+			if body != tt.want {
+				t.Errorf("convertLiquid(%q) = %q, want %q", tt.body, body, tt.want)
+			}
+			article := importedArticle{Name: "posts/a", Body: body, literal: literal}
+			if got := article.shortcodes(); !slices.Equal(got, tt.shortcodes) {
+				t.Errorf("shortcodes() = %q, want %q", got, tt.shortcodes)
+			}
+		})
+	}
+}
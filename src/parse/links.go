@@ -0,0 +1,212 @@
+package parse
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// sourceLinkPrefix marks link keys that refer to a source file rather than an output path.
+const sourceLinkPrefix = "source:"
+
+// ArticleLinkKeys returns the keys under which links to an article are recognized by
+// RewriteInternalLinks: its output path with and without the index file name, and its
+// source path relative to the input directory (e.g. "posts/a/index.html", "posts/a",
+// "source:posts/2024-01-01-a.md").
+func ArticleLinkKeys(article Article, settings Settings) []string {
+	keys := []string{path.Clean("/" + article.LinkToSelf)[1:]}
+	if dir, ok := strings.CutSuffix(article.LinkToSelf, settings.IndexName); ok {
+		keys = append(keys, strings.Trim(dir, "/"))
+	}
+	if rel, err := filepath.Rel(settings.InputPath, article.OriginalPath); err == nil {
+		keys = append(keys, sourceLinkPrefix+filepath.ToSlash(rel))
+	}
+	return keys
+}
+
+// alternatePath returns the path of an alternate version of an article's page, in the
+// format of ext, mirroring its LinkToSelf (e.g. "posts/a/index.html" -> "posts/a/index.gmi").
+func alternatePath(article Article, settings Settings, ext string) string {
+	if dir, ok := strings.CutSuffix(article.LinkToSelf, settings.IndexName); ok && (dir == "" || strings.HasSuffix(dir, "/")) {
+		return dir + "index" + ext
+	}
+	return strings.TrimSuffix(article.LinkToSelf, path.Ext(article.LinkToSelf)) + ext
+}
+
+// rebaseResources rewrites the relative resources of a parsed article body (images,
+// media and the like, see embeddedResourceAttrs) to paths from the site root, prefixed
+// with prefix, e.g. "img.png" in "posts/a/index.html" becomes prefix+"posts/a/img.png".
+func rebaseResources(doc *html.Node, article Article, prefix string) {
+	outputDir := path.Dir(article.LinkToSelf)
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, attr := range n.Attr {
+				if !slices.Contains(embeddedResourceAttrs[n.Data], attr.Key) {
+					continue
+				}
+				u, err := url.Parse(strings.TrimSpace(attr.Val))
+				if err != nil || u.IsAbs() || u.Host != "" || u.Opaque != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+					continue
+				}
+				u.Path = path.Join(outputDir, u.Path)
+				n.Attr[i].Val = prefix + u.String()
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+}
+
+// RewriteInternalLinks returns body, the content of article, with its links to other
+// articles replaced by targets[key] (see ArticleLinkKeys), keeping their fragment unless
+// the target already has one. Other relative links are made absolute with the site's
+// BaseUrl, so they keep working once the content is taken out of the site.
+func RewriteInternalLinks(article Article, body string, targets map[string]string, settings Settings) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse content of '%s': %w", article.OriginalPath, err)
+	}
+	rewriteLinks(doc, article, targets, settings, func(u *url.URL) string {
+		return settings.BaseUrl + u.RequestURI() + fragmentSuffix(u)
+	})
+	return getBodyContent(doc)
+}
+
+// linkResolver finds the site paths and articles that the links of an article point to.
+type linkResolver struct {
+	targets   map[string]string
+	settings  Settings
+	sourceDir string // Folder of the article's source file, relative to InputPath
+	outputDir string // Folder of the article's page, relative to the site root
+}
+
+// newLinkResolver returns a linkResolver for the links of article, looked up in targets
+// (see ArticleLinkKeys).
+func newLinkResolver(article Article, targets map[string]string, settings Settings) linkResolver {
+	r := linkResolver{targets: targets, settings: settings, outputDir: path.Dir(article.LinkToSelf)}
+	if rel, err := filepath.Rel(settings.InputPath, article.OriginalPath); err == nil {
+		r.sourceDir = path.Dir(filepath.ToSlash(rel))
+	}
+	return r
+}
+
+// resolve returns the site-root-relative path u points to, without leading or trailing
+// slashes, and the target of the article at that path, or an empty string. It reports
+// false for links outside the site and for non-navigational links (same-page anchors,
+// mailto: and the like).
+func (r linkResolver) resolve(u *url.URL) (sitePath string, target string, inSite bool) {
+	if u.Path == "" || u.Opaque != "" {
+		return "", "", false
+	}
+	var sourcePath string
+	switch {
+	case u.IsAbs() || u.Host != "":
+		rest, ok := strings.CutPrefix(u.Scheme+"://"+u.Host+u.Path, r.settings.BaseUrl+"/")
+		if !ok {
+			return "", "", false
+		}
+		sitePath = rest
+	case strings.HasPrefix(u.Path, "/"):
+		sitePath = strings.TrimPrefix(strings.TrimPrefix(u.Path, r.settings.BasePath), "/")
+	default:
+		sitePath = path.Join(r.outputDir, u.Path)
+		sourcePath = path.Join(r.sourceDir, u.Path)
+	}
+	sitePath = strings.Trim(path.Clean("/"+sitePath), "/")
+
+	for _, key := range []string{sitePath, path.Join(sitePath, r.settings.IndexName), sourceLinkPrefix + sourcePath} {
+		if target, ok := r.targets[key]; ok {
+			return sitePath, target, true
+		}
+	}
+	return sitePath, "", true
+}
+
+// rewriteLinks implements RewriteInternalLinks on a parsed document. Links to other site
+// paths are replaced by other(u), where u.Path is the site-root-relative path with a
+// leading slash.
+func rewriteLinks(doc *html.Node, article Article, targets map[string]string, settings Settings, other func(u *url.URL) string) {
+	r := newLinkResolver(article, targets, settings)
+	for _, a := range findAllElements(doc, "a") {
+		for i, attr := range a.Attr {
+			if attr.Key != "href" {
+				continue
+			}
+			u, err := url.Parse(strings.TrimSpace(attr.Val))
+			if err != nil {
+				continue
+			}
+			sitePath, target, inSite := r.resolve(u)
+			switch {
+			case target != "":
+				if u.Fragment != "" && !strings.Contains(target, "#") {
+					target += "#" + u.Fragment
+				}
+				a.Attr[i].Val = target
+			case inSite && !u.IsAbs() && u.Host == "":
+				trailingSlash := strings.HasSuffix(u.Path, "/") && sitePath != ""
+				u.Path = "/" + sitePath
+				if trailingSlash {
+					u.Path += "/"
+				}
+				a.Attr[i].Val = other(u)
+			}
+		}
+	}
+}
+
+// fragmentSuffix returns the "#fragment" part of u, or an empty string.
+func fragmentSuffix(u *url.URL) string {
+	if u.Fragment == "" {
+		return ""
+	}
+	return "#" + u.EscapedFragment()
+}
+
+// LinkArticles sets the Links of every article to the other articles its content links
+// to, and its Backlinks to the articles linking to it, in the order of articles.
+func LinkArticles(articles []Article, settings Settings) {
+	targets := map[string]string{}
+	indexes := map[string]int{}
+	for i, article := range articles {
+		for _, key := range ArticleLinkKeys(article, settings) {
+			targets[key] = article.LinkToSelf
+		}
+		indexes[article.LinkToSelf] = i
+		articles[i].Links, articles[i].Backlinks = nil, nil
+	}
+	for i, article := range articles {
+		doc, err := html.Parse(strings.NewReader(article.BodyContent))
+		if err != nil {
+			continue
+		}
+		r := newLinkResolver(article, targets, settings)
+		for _, a := range findAllElements(doc, "a") {
+			for _, attr := range a.Attr {
+				if attr.Key != "href" {
+					continue
+				}
+				u, err := url.Parse(strings.TrimSpace(attr.Val))
+				if err != nil {
+					continue
+				}
+				_, target, _ := r.resolve(u)
+				if target != "" && target != article.LinkToSelf && !slices.Contains(articles[i].Links, target) {
+					articles[i].Links = append(articles[i].Links, target)
+				}
+			}
+		}
+		for _, target := range articles[i].Links {
+			linked := &articles[indexes[target]]
+			linked.Backlinks = append(linked.Backlinks, ArticleRef{Title: article.Title, LinkToSelf: article.LinkToSelf})
+		}
+	}
+}
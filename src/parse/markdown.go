@@ -9,6 +9,8 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	texttemplate "text/template"
 	"time"
@@ -16,6 +18,7 @@ import (
 	"github.com/k3a/html2text"
 	mathjax "github.com/litao91/goldmark-mathjax"
 	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
@@ -26,28 +29,65 @@ import (
 )
 
 // Markdown is the configured Goldmark Markdown parser with frontmatter support.
-var Markdown = goldmark.New(
-	goldmark.WithRendererOptions(
-		rendererhtml.WithUnsafe(),
-		rendererhtml.WithHardWraps(),
-		rendererhtml.WithXHTML(),
-	),
-	goldmark.WithParserOptions(
-		parser.WithAttribute(),
-		parser.WithAutoHeadingID(),
-	),
-	goldmark.WithExtensions(
-		&frontmatter.Extender{},
-		mathjax.MathJax,
-		extension.Table,
-		extension.Strikethrough,
-		extension.Linkify,
-		extension.TaskList,
-		extension.Footnote,
-		extension.Typographer,
-	),
+// Fenced code blocks are highlighted at build time with Chroma, emitting classed spans
+// styled by the generated highlight.css. Blocks accept attributes such as
+// {linenos=true linenostart=10 hl_lines=[1,"3-5"]}.
+var Markdown = newMarkdown()
+
+// markdownMathML is Markdown with math rendered to MathML at build time.
+var markdownMathML = newMarkdown(&mathMLExtender{})
+
+// markdownObsidian and markdownObsidianMathML add the Markdown extensions of Obsidian
+// vaults to Markdown and markdownMathML.
+var (
+	markdownObsidian       = newMarkdown(&obsidianExtender{})
+	markdownObsidianMathML = newMarkdown(&obsidianExtender{}, &mathMLExtender{})
 )
 
+// newMarkdown builds a Goldmark instance with the site's parser and renderer options,
+// plus any additional extensions.
+func newMarkdown(extensions ...goldmark.Extender) goldmark.Markdown {
+	return goldmark.New(
+		goldmark.WithRendererOptions(
+			rendererhtml.WithUnsafe(),
+			rendererhtml.WithHardWraps(),
+			rendererhtml.WithXHTML(),
+		),
+		goldmark.WithParserOptions(
+			parser.WithAttribute(),
+			parser.WithAutoHeadingID(),
+		),
+		goldmark.WithExtensions(
+			&frontmatter.Extender{},
+			mathjax.MathJax,
+			extension.Table,
+			extension.Strikethrough,
+			extension.Linkify,
+			extension.TaskList,
+			extension.Footnote,
+			extension.Typographer,
+			highlighting.NewHighlighting(
+				highlighting.WithFormatOptions(highlightFormatterOptions()...),
+			),
+		),
+		goldmark.WithExtensions(extensions...),
+	)
+}
+
+// MarkdownFor returns the Markdown converter matching the settings' math rendering mode
+// and Obsidian extensions.
+func MarkdownFor(settings Settings) goldmark.Markdown {
+	switch {
+	case settings.Obsidian && settings.RenderMathML:
+		return markdownObsidianMathML
+	case settings.Obsidian:
+		return markdownObsidian
+	case settings.RenderMathML:
+		return markdownMathML
+	}
+	return Markdown
+}
+
 // MarkdownFile parses a Markdown file, extracts frontmatter, and populates an Article.
 // It returns the Article and a list of extracted resource paths (e.g., images).
 func MarkdownFile(path string, settings Settings) (Article, []string, error) {
@@ -56,11 +96,12 @@ func MarkdownFile(path string, settings Settings) (Article, []string, error) {
 		return Article{}, nil, fmt.Errorf("failed to read Markdown file '%s': %w", path, err)
 	}
 
-	// Create a context to store frontmatter.
-	context := parser.NewContext()
+	// Create a context to store frontmatter and resolve links to other files.
+	context := newParserContext(path, settings)
 
 	// Parse the Markdown content into an AST.
-	p := Markdown.Parser()
+	md := MarkdownFor(settings)
+	p := md.Parser()
 	reader := text.NewReader(data)
 	doc := p.Parse(reader, parser.WithContext(context))
 
@@ -87,7 +128,7 @@ func MarkdownFile(path string, settings Settings) (Article, []string, error) {
 
 	// Render to HTML.
 	var buf bytes.Buffer
-	r := Markdown.Renderer()
+	r := md.Renderer()
 	if err := r.Render(&buf, data, doc); err != nil {
 		return Article{}, nil, fmt.Errorf("failed to render Markdown to HTML for '%s': %w", path, err)
 	}
@@ -114,6 +155,7 @@ func MarkdownFile(path string, settings Settings) (Article, []string, error) {
 		TextContent:  textContent,
 		HtmlContent:  wrappedHtmlContent, // Initial HTML content (fragment)
 		BodyContent:  wrappedHtmlContent, // Save the fragment as BodyContent for RSS
+		NeedsMathJax: NeedsMathJax(rawHtmlContent),
 	}
 
 	// Decode frontmatter into the Article.
@@ -172,6 +214,26 @@ func MarkdownFile(path string, settings Settings) (Article, []string, error) {
 				article.ExternalLink = value.(string)
 			case "canonical_url":
 				article.CanonicalUrl = value.(string)
+			case "aliases":
+				article.Aliases = frontmatterStringList(value)
+			case "related":
+				article.RelatedPins = frontmatterStringList(value)
+			case "series":
+				article.Series = strings.TrimSpace(fmt.Sprint(value))
+			case "series_order":
+				order, err := strconv.Atoi(strings.TrimSpace(fmt.Sprint(value)))
+				if err != nil {
+					if !settings.IgnoreErrors {
+						return Article{}, nil, fmt.Errorf("failed to parse 'series_order' in '%s': %w", path, err)
+					}
+					log.Printf("Warning: Failed to parse 'series_order' in '%s': %v\n", path, err)
+				} else {
+					article.SeriesOrder = order
+				}
+			case "mirror":
+				if mirror, ok := frontmatterBool(value); ok {
+					article.NoMirror = !mirror
+				}
 			case "tags":
 				switch reflect.TypeOf(value).Kind() {
 				case reflect.Slice:
@@ -192,6 +254,13 @@ func MarkdownFile(path string, settings Settings) (Article, []string, error) {
 		}
 	}
 
+	// Merge inline #tags into the frontmatter tags.
+	for _, tag := range vaultContextOf(context).tags {
+		if !slices.ContainsFunc(article.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			article.Tags = append(article.Tags, tag)
+		}
+	}
+
 	// Set Created and Updated to file dates if not provided in frontmatter.
 	fileInfo, err := os.Stat(path)
 	if err != nil {
@@ -216,6 +285,43 @@ func MarkdownFile(path string, settings Settings) (Article, []string, error) {
 	return article, resources, nil
 }
 
+// frontmatterStringList reads a frontmatter value given either as a YAML list or
+// as a comma-separated string.
+func frontmatterStringList(value any) []string {
+	var items []string
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			if item == nil {
+				continue
+			}
+			if s := strings.TrimSpace(fmt.Sprint(item)); s != "" {
+				items = append(items, s)
+			}
+		}
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if s := strings.TrimSpace(item); s != "" {
+				items = append(items, s)
+			}
+		}
+	}
+	return items
+}
+
+// frontmatterBool reads a frontmatter flag given as a YAML boolean or as a string such
+// as "false". It reports false if the value is neither.
+func frontmatterBool(value any) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		return b, err == nil
+	}
+	return false, false
+}
+
 // FormatMarkdown applies an HTML template to the Markdown content of an article.
 // It injects article and settings into the provided template and updates HtmlContent.
 func FormatMarkdown(article *Article, settings Settings, tmpl *texttemplate.Template, assets fs.FS) error {
@@ -224,11 +330,13 @@ func FormatMarkdown(article *Article, settings Settings, tmpl *texttemplate.Temp
 		Art      Article
 		Ctt      template.HTML
 		Text     string
+		Related  []ArticleRef
 		Settings Settings
 	}{
 		Art:      *article,
 		Ctt:      template.HTML(article.HtmlContent),
 		Text:     article.TextContent,
+		Related:  article.Related,
 		Settings: settings,
 	})
 	if err != nil {
@@ -0,0 +1,872 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	mathjax "github.com/litao91/goldmark-mathjax"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// MathJaxMarker is the class prefix emitted for math that must be typeset in the browser.
+// Pages whose HTML contains it load the MathJax script.
+const MathJaxMarker = `<span class="math `
+
+// NeedsMathJax reports whether rendered HTML contains math left for client-side typesetting.
+func NeedsMathJax(htmlContent string) bool {
+	return strings.Contains(htmlContent, MathJaxMarker)
+}
+
+// mathMLExtender replaces the MathJax pass-through renderer with one that converts
+// TeX to MathML at build time, keeping the MathJax output for unsupported input.
+type mathMLExtender struct{}
+
+// Extend registers the MathML renderer with a higher priority than the MathJax renderers.
+func (e *mathMLExtender) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&mathMLRenderer{}, 500),
+	))
+}
+
+// mathMLRenderer renders inline and block math nodes as MathML.
+type mathMLRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (r *mathMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(mathjax.KindInlineMath, r.renderInlineMath)
+	reg.Register(mathjax.KindMathBlock, r.renderMathBlock)
+}
+
+func (r *mathMLRenderer) renderInlineMath(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	var tex bytes.Buffer
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		value := c.(*ast.Text).Segment.Value(source)
+		if bytes.HasSuffix(value, []byte("\n")) {
+			tex.Write(value[:len(value)-1])
+			if c != n.LastChild() {
+				tex.WriteByte(' ')
+			}
+		} else {
+			tex.Write(value)
+		}
+	}
+	if mathML, err := TeXToMathML(tex.String(), false); err == nil {
+		_, _ = w.WriteString(mathML)
+	} else {
+		_, _ = w.WriteString(MathJaxMarker + `inline">\(`)
+		_, _ = w.Write(tex.Bytes())
+		_, _ = w.WriteString(`\)</span>`)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *mathMLRenderer) renderMathBlock(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	var tex bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		tex.Write(line.Value(source))
+	}
+	if mathML, err := TeXToMathML(tex.String(), true); err == nil {
+		_, _ = w.WriteString(mathML + "\n")
+	} else {
+		_, _ = w.WriteString(`<p>` + MathJaxMarker + `display">\[`)
+		_, _ = w.Write(tex.Bytes())
+		_, _ = w.WriteString(`\]</span></p>` + "\n")
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// TeXToMathML converts a TeX math expression to a MathML <math> element.
+// It supports the commonly used subset of LaTeX math (scripts, fractions, roots,
+// Greek letters, operators, accents, fonts, delimiters and matrix-like environments)
+// and returns an error for anything else so callers can fall back to MathJax.
+func TeXToMathML(tex string, display bool) (string, error) {
+	p := &texParser{src: []rune(tex), display: display}
+	items, err := p.parseSequence()
+	if err != nil {
+		return "", err
+	}
+	if tok := p.peek(); tok.kind != texEOF {
+		return "", fmt.Errorf("unexpected '%s' at position %d", tok.val, p.pos)
+	}
+
+	var b strings.Builder
+	b.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML"`)
+	if display {
+		b.WriteString(` display="block"`)
+	}
+	b.WriteString(`>`)
+	b.WriteString(mrow(items))
+	b.WriteString(`</math>`)
+	return b.String(), nil
+}
+
+// texTokenKind classifies a lexical token of TeX math input.
+type texTokenKind int
+
+const (
+	texEOF texTokenKind = iota
+	texCommand
+	texLetter
+	texNumber
+	texChar
+	texOpenBrace
+	texCloseBrace
+	texSup
+	texSub
+	texAmp
+)
+
+// texToken is a single lexical token. For commands, val holds the name without the backslash.
+type texToken struct {
+	kind texTokenKind
+	val  string
+	end  int
+}
+
+// texParser is a recursive-descent parser emitting MathML for TeX math.
+type texParser struct {
+	src     []rune
+	pos     int
+	display bool
+	variant string
+}
+
+// skipSpace advances past whitespace, which is insignificant in math mode.
+func (p *texParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// peek returns the next token without consuming it.
+func (p *texParser) peek() texToken {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return texToken{kind: texEOF, end: p.pos}
+	}
+	c := p.src[p.pos]
+	switch {
+	case c == '\\':
+		i := p.pos + 1
+		if i >= len(p.src) {
+			return texToken{kind: texChar, val: "\\", end: i}
+		}
+		if !isASCIILetter(p.src[i]) {
+			return texToken{kind: texCommand, val: string(p.src[i]), end: i + 1}
+		}
+		for i < len(p.src) && isASCIILetter(p.src[i]) {
+			i++
+		}
+		return texToken{kind: texCommand, val: string(p.src[p.pos+1 : i]), end: i}
+	case c == '{':
+		return texToken{kind: texOpenBrace, val: "{", end: p.pos + 1}
+	case c == '}':
+		return texToken{kind: texCloseBrace, val: "}", end: p.pos + 1}
+	case c == '^':
+		return texToken{kind: texSup, val: "^", end: p.pos + 1}
+	case c == '_':
+		return texToken{kind: texSub, val: "_", end: p.pos + 1}
+	case c == '&':
+		return texToken{kind: texAmp, val: "&", end: p.pos + 1}
+	case unicode.IsDigit(c) || (c == '.' && p.pos+1 < len(p.src) && unicode.IsDigit(p.src[p.pos+1])):
+		i := p.pos
+		for i < len(p.src) && (unicode.IsDigit(p.src[i]) || (p.src[i] == '.' && i+1 < len(p.src) && unicode.IsDigit(p.src[i+1]))) {
+			i++
+		}
+		return texToken{kind: texNumber, val: string(p.src[p.pos:i]), end: i}
+	case unicode.IsLetter(c):
+		return texToken{kind: texLetter, val: string(c), end: p.pos + 1}
+	default:
+		return texToken{kind: texChar, val: string(c), end: p.pos + 1}
+	}
+}
+
+// next consumes and returns the next token.
+func (p *texParser) next() texToken {
+	tok := p.peek()
+	p.pos = tok.end
+	return tok
+}
+
+// atSequenceEnd reports whether tok terminates the current sequence.
+func atSequenceEnd(tok texToken) bool {
+	switch tok.kind {
+	case texEOF, texCloseBrace, texAmp:
+		return true
+	case texCommand:
+		return tok.val == "\\" || tok.val == "end" || tok.val == "right" || tok.val == "cr"
+	}
+	return false
+}
+
+// parseSequence parses atoms (with their scripts) until a terminator is reached.
+func (p *texParser) parseSequence() ([]string, error) {
+	var items []string
+	for {
+		tok := p.peek()
+		if atSequenceEnd(tok) {
+			return items, nil
+		}
+		item, err := p.parseScripted()
+		if err != nil {
+			return nil, err
+		}
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+}
+
+// parseScripted parses an atom followed by any superscripts, subscripts or primes.
+func (p *texParser) parseScripted() (string, error) {
+	var base string
+	var movable bool
+	var err error
+
+	switch p.peek().kind {
+	case texSup, texSub:
+		base = "<mrow></mrow>"
+	default:
+		base, movable, err = p.parseAtom()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var sub, sup string
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == texSup && sup == "":
+			p.next()
+			if sup, err = p.parseArgument(); err != nil {
+				return "", err
+			}
+		case tok.kind == texSub && sub == "":
+			p.next()
+			if sub, err = p.parseArgument(); err != nil {
+				return "", err
+			}
+		case tok.kind == texChar && tok.val == "'" && sup == "":
+			primes := ""
+			for p.peek().kind == texChar && p.peek().val == "'" {
+				p.next()
+				primes += "′"
+			}
+			sup = "<mo>" + primes + "</mo>"
+		case tok.kind == texCommand && (tok.val == "limits" || tok.val == "nolimits"):
+			p.next()
+			movable = tok.val == "limits"
+		case tok.kind == texSup || tok.kind == texSub:
+			return "", fmt.Errorf("double script at position %d", p.pos)
+		default:
+			if sub == "" && sup == "" {
+				return base, nil
+			}
+			under, over := "msub", "msup"
+			both := "msubsup"
+			if movable && p.display {
+				under, over, both = "munder", "mover", "munderover"
+			}
+			switch {
+			case sub != "" && sup != "":
+				return "<" + both + ">" + base + sub + sup + "</" + both + ">", nil
+			case sub != "":
+				return "<" + under + ">" + base + sub + "</" + under + ">", nil
+			default:
+				return "<" + over + ">" + base + sup + "</" + over + ">", nil
+			}
+		}
+	}
+}
+
+// parseArgument parses a required argument: a braced group or a single atom.
+func (p *texParser) parseArgument() (string, error) {
+	tok := p.peek()
+	if tok.kind == texEOF || atSequenceEnd(tok) {
+		return "", fmt.Errorf("missing argument at position %d", p.pos)
+	}
+	item, _, err := p.parseAtom()
+	return item, err
+}
+
+// parseGroup parses a braced group and returns its MathML items.
+func (p *texParser) parseGroup() ([]string, error) {
+	if tok := p.next(); tok.kind != texOpenBrace {
+		return nil, fmt.Errorf("expected '{' at position %d", p.pos)
+	}
+	items, err := p.parseSequence()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.next(); tok.kind != texCloseBrace {
+		return nil, fmt.Errorf("expected '}' at position %d", p.pos)
+	}
+	return items, nil
+}
+
+// parseRawGroup reads a braced group verbatim, for text-mode arguments and environment names.
+func (p *texParser) parseRawGroup() (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) || p.src[p.pos] != '{' {
+		return "", fmt.Errorf("expected '{' at position %d", p.pos)
+	}
+	depth := 0
+	start := p.pos + 1
+	for i := p.pos; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos = i + 1
+				return string(p.src[start:i]), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unterminated group starting at position %d", start-1)
+}
+
+// parseAtom parses a single atom. The boolean result reports whether the atom is a
+// large operator whose scripts are placed above and below it in display mode.
+func (p *texParser) parseAtom() (string, bool, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case texOpenBrace:
+		items, err := p.parseGroup()
+		if err != nil {
+			return "", false, err
+		}
+		return mrow(items), false, nil
+	case texNumber:
+		p.next()
+		return "<mn>" + p.styled(tok.val) + "</mn>", false, nil
+	case texLetter:
+		p.next()
+		return "<mi>" + p.styled(tok.val) + "</mi>", false, nil
+	case texChar:
+		p.next()
+		return charToMathML(tok.val)
+	case texCommand:
+		p.next()
+		return p.parseCommand(tok.val)
+	}
+	return "", false, fmt.Errorf("unexpected '%s' at position %d", tok.val, p.pos)
+}
+
+// charToMathML converts a literal non-letter character.
+func charToMathML(c string) (string, bool, error) {
+	switch c {
+	case "-":
+		return "<mo>−</mo>", false, nil
+	case "*":
+		return "<mo>∗</mo>", false, nil
+	case "'":
+		return "<mo>′</mo>", false, nil
+	case "~":
+		return `<mspace width="0.333em"></mspace>`, false, nil
+	case "(", ")", "[", "]":
+		return `<mo stretchy="false">` + c + "</mo>", false, nil
+	case "$", "%", "#", "\\":
+		return "", false, fmt.Errorf("unsupported character '%s'", c)
+	}
+	return "<mo>" + html.EscapeString(c) + "</mo>", false, nil
+}
+
+// parseCommand converts a control sequence whose backslash and name have been consumed.
+func (p *texParser) parseCommand(name string) (string, bool, error) {
+	if s, ok := texIdentifiers[name]; ok {
+		return "<mi>" + s + "</mi>", false, nil
+	}
+	if s, ok := texUprightIdentifiers[name]; ok {
+		return `<mi mathvariant="normal">` + s + "</mi>", false, nil
+	}
+	if s, ok := texOperators[name]; ok {
+		return "<mo>" + html.EscapeString(s) + "</mo>", false, nil
+	}
+	if s, ok := texLargeOperators[name]; ok {
+		// Integrals keep their limits to the side, as in LaTeX.
+		movable := !strings.Contains(name, "int")
+		return "<mo>" + s + "</mo>", movable, nil
+	}
+	if _, ok := texFunctions[name]; ok {
+		return "<mi>" + name + "</mi>", false, nil
+	}
+	if s, ok := texLimitFunctions[name]; ok {
+		return "<mi>" + s + "</mi>", true, nil
+	}
+	if width, ok := texSpaces[name]; ok {
+		return `<mspace width="` + width + `"></mspace>`, false, nil
+	}
+	if accent, ok := texAccents[name]; ok {
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		return `<mover accent="true">` + arg + "<mo>" + accent + "</mo></mover>", false, nil
+	}
+	if variant, ok := texFontVariants[name]; ok {
+		previous := p.variant
+		p.variant = variant
+		arg, err := p.parseArgument()
+		p.variant = previous
+		return arg, false, err
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		den, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		return "<mfrac>" + num + den + "</mfrac>", false, nil
+	case "binom", "dbinom", "tbinom":
+		top, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		bottom, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		return `<mrow><mo>(</mo><mfrac linethickness="0">` + top + bottom + `</mfrac><mo>)</mo></mrow>`, false, nil
+	case "sqrt":
+		var index string
+		p.skipSpace()
+		if p.pos < len(p.src) && p.src[p.pos] == '[' {
+			end := p.pos + 1
+			for end < len(p.src) && p.src[end] != ']' {
+				end++
+			}
+			if end >= len(p.src) {
+				return "", false, fmt.Errorf("unterminated root index at position %d", p.pos)
+			}
+			sub := &texParser{src: p.src[p.pos+1 : end], display: false}
+			items, err := sub.parseSequence()
+			if err != nil {
+				return "", false, err
+			}
+			if tok := sub.peek(); tok.kind != texEOF {
+				return "", false, fmt.Errorf("unexpected '%s' in root index", tok.val)
+			}
+			index = mrow(items)
+			p.pos = end + 1
+		}
+		radicand, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		if index != "" {
+			return "<mroot>" + radicand + index + "</mroot>", false, nil
+		}
+		return "<msqrt>" + radicand + "</msqrt>", false, nil
+	case "text", "textrm", "textnormal", "mbox", "textit", "textbf":
+		raw, err := p.parseRawGroup()
+		if err != nil {
+			return "", false, err
+		}
+		if strings.ContainsAny(raw, "\\$") {
+			return "", false, fmt.Errorf("unsupported content in \\%s", name)
+		}
+		return "<mtext>" + html.EscapeString(raw) + "</mtext>", false, nil
+	case "mathrm", "operatorname":
+		raw, err := p.parseRawGroup()
+		if err != nil {
+			return "", false, err
+		}
+		if strings.ContainsAny(raw, "\\${}^_") {
+			return "", false, fmt.Errorf("unsupported content in \\%s", name)
+		}
+		raw = strings.TrimSpace(raw)
+		if name == "operatorname" {
+			return "<mi>" + html.EscapeString(raw) + "</mi>", false, nil
+		}
+		return `<mi mathvariant="normal">` + html.EscapeString(raw) + "</mi>", false, nil
+	case "overset", "stackrel", "underset":
+		script, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		base, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		if name == "underset" {
+			return "<munder>" + base + script + "</munder>", false, nil
+		}
+		return "<mover>" + base + script + "</mover>", false, nil
+	case "underline":
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		return `<munder accentunder="true">` + arg + "<mo>_</mo></munder>", false, nil
+	case "underbrace":
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		return `<munder accentunder="true">` + arg + "<mo>⏟</mo></munder>", true, nil
+	case "overbrace":
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		return `<mover accent="true">` + arg + "<mo>⏞</mo></mover>", true, nil
+	case "left":
+		return p.parseLeftRight()
+	case "big", "Big", "bigg", "Bigg", "bigl", "bigr", "Bigl", "Bigr", "biggl", "biggr", "Biggl", "Biggr":
+		delim, err := p.parseDelimiter()
+		if err != nil {
+			return "", false, err
+		}
+		return `<mo stretchy="false">` + delim + "</mo>", false, nil
+	case "begin":
+		return p.parseEnvironment()
+	case "displaystyle", "textstyle", "limits", "nolimits":
+		return "", false, nil
+	}
+	return "", false, fmt.Errorf("unsupported command '\\%s'", name)
+}
+
+// parseDelimiter reads a delimiter after \left, \right or a \big-style command.
+// An empty string is returned for the invisible "." delimiter.
+func (p *texParser) parseDelimiter() (string, error) {
+	tok := p.next()
+	switch tok.kind {
+	case texChar:
+		switch tok.val {
+		case ".":
+			return "", nil
+		case "(", ")", "[", "]", "|", "/":
+			return tok.val, nil
+		case "<":
+			return "⟨", nil
+		case ">":
+			return "⟩", nil
+		}
+	case texCommand:
+		if d, ok := texDelimiters[tok.val]; ok {
+			return d, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported delimiter '%s'", tok.val)
+}
+
+// parseLeftRight parses a \left ... \right pair after \left has been consumed.
+func (p *texParser) parseLeftRight() (string, bool, error) {
+	open, err := p.parseDelimiter()
+	if err != nil {
+		return "", false, err
+	}
+	items, err := p.parseSequence()
+	if err != nil {
+		return "", false, err
+	}
+	if tok := p.next(); tok.kind != texCommand || tok.val != "right" {
+		return "", false, fmt.Errorf("\\left without matching \\right")
+	}
+	closing, err := p.parseDelimiter()
+	if err != nil {
+		return "", false, err
+	}
+
+	var b strings.Builder
+	b.WriteString("<mrow>")
+	if open != "" {
+		b.WriteString(`<mo fence="true">` + html.EscapeString(open) + "</mo>")
+	}
+	b.WriteString(strings.Join(items, ""))
+	if closing != "" {
+		b.WriteString(`<mo fence="true">` + html.EscapeString(closing) + "</mo>")
+	}
+	b.WriteString("</mrow>")
+	return b.String(), false, nil
+}
+
+// texEnvironments lists the supported matrix-like environments with their delimiters
+// and column alignment.
+var texEnvironments = map[string]struct {
+	open, close, align string
+}{
+	"matrix":      {"", "", ""},
+	"smallmatrix": {"", "", ""},
+	"pmatrix":     {"(", ")", ""},
+	"bmatrix":     {"[", "]", ""},
+	"Bmatrix":     {"{", "}", ""},
+	"vmatrix":     {"|", "|", ""},
+	"Vmatrix":     {"‖", "‖", ""},
+	"cases":       {"{", "", "left left"},
+	"aligned":     {"", "", "right left"},
+	"align":       {"", "", "right left"},
+	"align*":      {"", "", "right left"},
+	"gathered":    {"", "", ""},
+	"array":       {"", "", ""},
+}
+
+// parseEnvironment parses \begin{name} ... \end{name} after \begin has been consumed.
+func (p *texParser) parseEnvironment() (string, bool, error) {
+	name, err := p.parseRawGroup()
+	if err != nil {
+		return "", false, err
+	}
+	env, ok := texEnvironments[name]
+	if !ok {
+		return "", false, fmt.Errorf("unsupported environment '%s'", name)
+	}
+	if name == "array" {
+		// The column specification only affects alignment; skip it.
+		if _, err := p.parseRawGroup(); err != nil {
+			return "", false, err
+		}
+	}
+
+	var rows [][]string
+	var row []string
+	for {
+		items, err := p.parseSequence()
+		if err != nil {
+			return "", false, err
+		}
+		row = append(row, mrow(items))
+
+		tok := p.next()
+		switch {
+		case tok.kind == texAmp:
+			continue
+		case tok.kind == texCommand && (tok.val == "\\" || tok.val == "cr"):
+			rows = append(rows, row)
+			row = nil
+			continue
+		case tok.kind == texCommand && tok.val == "end":
+			endName, err := p.parseRawGroup()
+			if err != nil {
+				return "", false, err
+			}
+			if endName != name {
+				return "", false, fmt.Errorf("\\begin{%s} closed by \\end{%s}", name, endName)
+			}
+		default:
+			return "", false, fmt.Errorf("unterminated environment '%s'", name)
+		}
+		break
+	}
+	// A trailing \\ leaves an empty final row, which LaTeX ignores.
+	if !(len(row) == 1 && row[0] == "<mrow></mrow>") {
+		rows = append(rows, row)
+	}
+
+	var b strings.Builder
+	b.WriteString("<mrow>")
+	if env.open != "" {
+		b.WriteString(`<mo fence="true">` + env.open + "</mo>")
+	}
+	b.WriteString("<mtable")
+	if env.align != "" {
+		b.WriteString(` columnalign="` + env.align + `"`)
+	}
+	b.WriteString(">")
+	for _, r := range rows {
+		b.WriteString("<mtr>")
+		for _, cell := range r {
+			b.WriteString("<mtd>" + cell + "</mtd>")
+		}
+		b.WriteString("</mtr>")
+	}
+	b.WriteString("</mtable>")
+	if env.close != "" {
+		b.WriteString(`<mo fence="true">` + env.close + "</mo>")
+	}
+	b.WriteString("</mrow>")
+	return b.String(), false, nil
+}
+
+// styled applies the active font variant (\mathbb, \mathbf, ...) to letters and digits.
+func (p *texParser) styled(s string) string {
+	if p.variant == "" {
+		return html.EscapeString(s)
+	}
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteRune(mathAlphanumeric(p.variant, r))
+	}
+	return html.EscapeString(b.String())
+}
+
+// mathAlphanumeric maps an ASCII letter or digit to the Unicode Mathematical
+// Alphanumeric Symbols block for the given variant.
+func mathAlphanumeric(variant string, r rune) rune {
+	if exceptions, ok := texVariantExceptions[variant]; ok {
+		if e, ok := exceptions[r]; ok {
+			return e
+		}
+	}
+	bases, ok := texVariantBases[variant]
+	if !ok {
+		return r
+	}
+	switch {
+	case r >= 'A' && r <= 'Z' && bases[0] != 0:
+		return bases[0] + (r - 'A')
+	case r >= 'a' && r <= 'z' && bases[1] != 0:
+		return bases[1] + (r - 'a')
+	case r >= '0' && r <= '9' && bases[2] != 0:
+		return bases[2] + (r - '0')
+	}
+	return r
+}
+
+// mrow joins items, wrapping them in <mrow> unless there is exactly one.
+func mrow(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return "<mrow>" + strings.Join(items, "") + "</mrow>"
+}
+
+// isASCIILetter reports whether r can be part of a TeX control word.
+func isASCIILetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// texFontVariants maps font commands to a variant name used by mathAlphanumeric.
+var texFontVariants = map[string]string{
+	"mathbf":     "bold",
+	"boldsymbol": "bold",
+	"bm":         "bold",
+	"mathbb":     "double-struck",
+	"mathcal":    "script",
+	"mathscr":    "script",
+	"mathfrak":   "fraktur",
+	"mathsf":     "sans-serif",
+	"mathtt":     "monospace",
+	"mathit":     "",
+	"mathnormal": "",
+}
+
+// texVariantBases holds the code points of 'A', 'a' and '0' for each variant (0 if absent).
+var texVariantBases = map[string][3]rune{
+	"bold":          {0x1D400, 0x1D41A, 0x1D7CE},
+	"double-struck": {0x1D538, 0x1D552, 0x1D7D8},
+	"script":        {0x1D49C, 0x1D4B6, 0},
+	"fraktur":       {0x1D504, 0x1D51E, 0},
+	"sans-serif":    {0x1D5A0, 0x1D5BA, 0x1D7E2},
+	"monospace":     {0x1D670, 0x1D68A, 0x1D7F6},
+}
+
+// texVariantExceptions lists letters that live in the Letterlike Symbols block
+// instead of the Mathematical Alphanumeric Symbols block.
+var texVariantExceptions = map[string]map[rune]rune{
+	"double-struck": {'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ'},
+	"script": {'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ', 'R': 'ℛ',
+		'e': 'ℯ', 'g': 'ℊ', 'o': 'ℴ'},
+	"fraktur": {'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ'},
+}
+
+// texIdentifiers maps commands rendered as (italic) identifiers.
+var texIdentifiers = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"ell": "ℓ", "hbar": "ℏ", "imath": "ı", "jmath": "ȷ", "wp": "℘",
+}
+
+// texUprightIdentifiers maps commands rendered as upright identifiers.
+var texUprightIdentifiers = map[string]string{
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "emptyset": "∅", "varnothing": "∅",
+	"aleph": "ℵ", "Re": "ℜ", "Im": "ℑ", "top": "⊤", "bot": "⊥", "angle": "∠",
+	"triangle": "△", "square": "□", "degree": "°", "checkmark": "✓",
+	"%": "%", "$": "$", "#": "#", "_": "_",
+}
+
+// texOperators maps commands rendered as operators, relations and punctuation.
+var texOperators = map[string]string{
+	"pm": "±", "mp": "∓", "times": "×", "div": "÷", "cdot": "⋅", "ast": "∗", "star": "⋆",
+	"circ": "∘", "bullet": "∙", "oplus": "⊕", "ominus": "⊖", "otimes": "⊗", "odot": "⊙",
+	"cap": "∩", "cup": "∪", "wedge": "∧", "land": "∧", "vee": "∨", "lor": "∨",
+	"setminus": "∖", "backslash": "∖", "dagger": "†", "ddagger": "‡",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "approx": "≈",
+	"equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅", "propto": "∝", "ll": "≪", "gg": "≫",
+	"prec": "≺", "succ": "≻", "preceq": "⪯", "succeq": "⪰", "doteq": "≐", "asymp": "≍",
+	"subset": "⊂", "supset": "⊃", "subseteq": "⊆", "supseteq": "⊇", "in": "∈",
+	"notin": "∉", "ni": "∋", "perp": "⊥", "parallel": "∥", "mid": "∣", "nmid": "∤",
+	"vdash": "⊢", "models": "⊨",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←", "leftrightarrow": "↔",
+	"Rightarrow": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔", "iff": "⟺",
+	"implies": "⟹", "impliedby": "⟸", "mapsto": "↦", "longrightarrow": "⟶",
+	"longleftarrow": "⟵", "longmapsto": "⟼", "uparrow": "↑", "downarrow": "↓",
+	"hookrightarrow": "↪", "rightharpoonup": "⇀",
+	"forall": "∀", "exists": "∃", "nexists": "∄", "neg": "¬", "lnot": "¬",
+	"ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱", "prime": "′",
+	"colon": ":", "lbrace": "{", "rbrace": "}", "{": "{", "}": "}", "|": "‖", "&": "&",
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+	"vert": "|", "Vert": "‖", "lvert": "|", "rvert": "|", "lVert": "‖", "rVert": "‖",
+	"mod": "mod", "bmod": "mod",
+}
+
+// texLargeOperators maps commands rendered as large operators.
+var texLargeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬", "iiint": "∭",
+	"oint": "∮", "bigcup": "⋃", "bigcap": "⋂", "bigoplus": "⨁", "bigotimes": "⨂",
+	"bigodot": "⨀", "bigvee": "⋁", "bigwedge": "⋀", "bigsqcup": "⨆",
+}
+
+// texFunctions lists named functions rendered upright with scripts to the side.
+var texFunctions = map[string]struct{}{
+	"sin": {}, "cos": {}, "tan": {}, "cot": {}, "sec": {}, "csc": {}, "arcsin": {},
+	"arccos": {}, "arctan": {}, "sinh": {}, "cosh": {}, "tanh": {}, "coth": {},
+	"log": {}, "ln": {}, "lg": {}, "exp": {}, "dim": {}, "ker": {}, "deg": {},
+	"arg": {}, "hom": {},
+}
+
+// texLimitFunctions maps named operators whose limits go underneath in display mode.
+var texLimitFunctions = map[string]string{
+	"lim": "lim", "limsup": "lim sup", "liminf": "lim inf", "max": "max", "min": "min",
+	"sup": "sup", "inf": "inf", "det": "det", "gcd": "gcd", "Pr": "Pr",
+}
+
+// texSpaces maps spacing commands to widths.
+var texSpaces = map[string]string{
+	",": "0.1667em", "thinspace": "0.1667em", ":": "0.2222em", ">": "0.2222em",
+	"medspace": "0.2222em", ";": "0.2778em", "thickspace": "0.2778em", " ": "0.25em",
+	"quad": "1em", "qquad": "2em", "!": "-0.1667em", "negthinspace": "-0.1667em",
+}
+
+// texAccents maps accent commands to the combining mark placed over their argument.
+var texAccents = map[string]string{
+	"hat": "^", "widehat": "^", "check": "ˇ", "tilde": "~", "widetilde": "~",
+	"bar": "¯", "overline": "¯", "vec": "→", "overrightarrow": "→",
+	"overleftarrow": "←", "dot": "˙", "ddot": "¨", "acute": "´", "grave": "`",
+	"breve": "˘",
+}
+
+// texDelimiters maps delimiter commands usable with \left, \right and \big.
+var texDelimiters = map[string]string{
+	"{": "{", "}": "}", "lbrace": "{", "rbrace": "}", "langle": "⟨", "rangle": "⟩",
+	"lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉", "vert": "|", "Vert": "‖",
+	"lvert": "|", "rvert": "|", "lVert": "‖", "rVert": "‖", "|": "‖",
+	"uparrow": "↑", "downarrow": "↓", "backslash": "∖",
+}
@@ -0,0 +1,122 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+// mathTag wraps MathML items in the <math> element that TeXToMathML returns.
+func mathTag(items string, display bool) string {
+	if display {
+		return `<math xmlns="http://www.w3.org/1998/Math/MathML" display="block">` + items + `</math>`
+	}
+	return `<math xmlns="http://www.w3.org/1998/Math/MathML">` + items + `</math>`
+}
+
+func TestTeXToMathML(t *testing.T) {
+	tests := []struct {
+		name    string
+		tex     string
+		display bool
+		want    string // Content of the <math> element
+	}{
+		{"identifier", `x`, false, `<mi>x</mi>`},
+		{"number", `12.5`, false, `<mn>12.5</mn>`},
+		{"escaped operator", `a<b`, false, `<mrow><mi>a</mi><mo>&lt;</mo><mi>b</mi></mrow>`},
+		{"braces", `{a}`, false, `<mi>a</mi>`},
+		{"superscript", `x^2`, false, `<msup><mi>x</mi><mn>2</mn></msup>`},
+		{"both scripts", `x_i^2`, false, `<msubsup><mi>x</mi><mi>i</mi><mn>2</mn></msubsup>`},
+		{"prime", `f'(x)`, false, `<mrow><msup><mi>f</mi><mo>′</mo></msup><mo stretchy="false">(</mo><mi>x</mi><mo stretchy="false">)</mo></mrow>`},
+		{"fraction", `\frac{a}{b}`, false, `<mfrac><mi>a</mi><mi>b</mi></mfrac>`},
+		{"square root", `\sqrt{x}`, false, `<msqrt><mi>x</mi></msqrt>`},
+		{"nth root", `\sqrt[3]{x}`, false, `<mroot><mi>x</mi><mn>3</mn></mroot>`},
+		{"greek letters", `\alpha+\beta`, false, `<mrow><mi>α</mi><mo>+</mo><mi>β</mi></mrow>`},
+		{"function name", `\sin x`, false, `<mrow><mi>sin</mi><mi>x</mi></mrow>`},
+		{"operatorname", `\operatorname{sin} x`, false, `<mrow><mi>sin</mi><mi>x</mi></mrow>`},
+		{"bold font", `\mathbf{v}`, false, `<mi>𝐯</mi>`},
+		{"accent", `\hat{x}`, false, `<mover accent="true"><mi>x</mi><mo>^</mo></mover>`},
+		{"text", `\text{if } x`, false, `<mrow><mtext>if </mtext><mi>x</mi></mrow>`},
+		{"integral", `\int_0^1 f`, false, `<mrow><msubsup><mo>∫</mo><mn>0</mn><mn>1</mn></msubsup><mi>f</mi></mrow>`},
+		{
+			"inline sum", `\sum_{i=1}^n i`, false,
+			`<mrow><msubsup><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></msubsup><mi>i</mi></mrow>`,
+		},
+		{
+			"display sum", `\sum_{i=1}^n i`, true,
+			`<mrow><munderover><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover><mi>i</mi></mrow>`,
+		},
+		{
+			"nested fraction in delimiters", `\left(\frac{1}{2}\right)`, false,
+			`<mrow><mo fence="true">(</mo><mfrac><mn>1</mn><mn>2</mn></mfrac><mo fence="true">)</mo></mrow>`,
+		},
+		{
+			"nested scripts and roots", `\sqrt{x^{2}+\frac{1}{y_j}}`, false,
+			`<msqrt><mrow><msup><mi>x</mi><mn>2</mn></msup><mo>+</mo><mfrac><mn>1</mn><msub><mi>y</mi><mi>j</mi></msub></mfrac></mrow></msqrt>`,
+		},
+		{
+			"matrix", `\begin{pmatrix}a&b\\c&d\end{pmatrix}`, false,
+			`<mrow><mo fence="true">(</mo><mtable><mtr><mtd><mi>a</mi></mtd><mtd><mi>b</mi></mtd></mtr><mtr><mtd><mi>c</mi></mtd><mtd><mi>d</mi></mtd></mtr></mtable><mo fence="true">)</mo></mrow>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TeXToMathML(tt.tex, tt.display)
+			if err != nil {
+				t.Fatalf("TeXToMathML(%q) returned error: %v", tt.tex, err)
+			}
+			if want := mathTag(tt.want, tt.display); got != want {
+				t.Errorf("TeXToMathML(%q) =\n%s\nwant\n%s", tt.tex, got, want)
+			}
+		})
+	}
+}
+
+func TestTeXToMathMLUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		tex  string
+	}{
+		{"unknown command", `\unknowncmd x`},
+		{"unknown environment", `\begin{foo}x\end{foo}`},
+		{"missing argument", `\frac{a}`},
+		{"missing script", `x^`},
+		{"unclosed group", `{a`},
+		{"unmatched right", `x\right)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := TeXToMathML(tt.tex, false); err == nil {
+				t.Errorf("TeXToMathML(%q) = %s, want an error", tt.tex, got)
+			}
+		})
+	}
+}
+
+func TestMathMLFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+		mathJax  bool
+	}{
+		{"inline", `Let $x^2$ be.`, mathTag(`<msup><mi>x</mi><mn>2</mn></msup>`, false), false},
+		{"display", "$$\n\\frac{a}{b}\n$$", mathTag(`<mfrac><mi>a</mi><mi>b</mi></mfrac>`, true), false},
+		{"inline fallback", `Let $\unknowncmd x$ be.`, MathJaxMarker + `inline">\(\unknowncmd x\)</span>`, true},
+		{"display fallback", "$$\n\\unknowncmd x\n$$", MathJaxMarker + `display">\[\unknowncmd x`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			if err := MarkdownFor(Settings{RenderMathML: true}).Convert([]byte(tt.markdown), &buf); err != nil {
+				t.Fatalf("Convert(%q) returned error: %v", tt.markdown, err)
+			}
+			got := buf.String()
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("Convert(%q) =\n%s\nwant it to contain\n%s", tt.markdown, got, tt.want)
+			}
+			if NeedsMathJax(got) != tt.mathJax {
+				t.Errorf("NeedsMathJax(%q) = %v, want %v", got, !tt.mathJax, tt.mathJax)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+)
+
+// minifyMediaTypes maps output file extensions to the media types handled by the minifier.
+var minifyMediaTypes = map[string]string{
+	".html": "text/html",
+	".htm":  "text/html",
+	".css":  "text/css",
+	".js":   "application/javascript",
+	".mjs":  "application/javascript",
+}
+
+// newMinifier returns the minifier used for generated output.
+// Only the HTML minifier is registered for pages: inline <script> and <style> contents are
+// left untouched so the hashes collected for the Content-Security-Policy stay valid.
+func newMinifier() *minify.M {
+	m := minify.New()
+	m.Add("text/html", &html.Minifier{
+		KeepDocumentTags:    true,
+		KeepEndTags:         true,
+		KeepSpecialComments: true,
+	})
+	return m
+}
+
+// newAssetMinifier returns the minifier for standalone stylesheets and scripts.
+func newAssetMinifier() *minify.M {
+	m := minify.New()
+	m.AddFunc("text/css", css.Minify)
+	m.AddFunc("application/javascript", js.Minify)
+	return m
+}
+
+// MinifyStats accumulates the size savings of minification over a build.
+// It is safe for concurrent use.
+type MinifyStats struct {
+	mu     sync.Mutex
+	Files  int
+	Before int64
+	After  int64
+}
+
+// Add records one minified file.
+func (s *MinifyStats) Add(before int, after int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Files++
+	s.Before += int64(before)
+	s.After += int64(after)
+}
+
+// Summary returns a one-line, human-readable report of the savings.
+func (s *MinifyStats) Summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := s.Before - s.After
+	percent := 0.0
+	if s.Before > 0 {
+		percent = float64(saved) / float64(s.Before) * 100
+	}
+	return fmt.Sprintf("Minified %d files: %s -> %s (saved %s, %.1f%%)",
+		s.Files, formatByteSize(s.Before), formatByteSize(s.After), formatByteSize(saved), percent)
+}
+
+// formatByteSize renders a byte count using binary units.
+func formatByteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// MinifyContent minifies content according to the extension of fileName.
+// Unsupported file types are returned unchanged.
+func MinifyContent(fileName string, content []byte) ([]byte, error) {
+	mediaType, ok := minifyMediaTypes[strings.ToLower(filepath.Ext(fileName))]
+	if !ok {
+		return content, nil
+	}
+	m := newAssetMinifier()
+	if mediaType == "text/html" {
+		m = newMinifier()
+	}
+	var buf bytes.Buffer
+	if err := m.Minify(mediaType, &buf, bytes.NewReader(content)); err != nil {
+		return nil, fmt.Errorf("failed to minify '%s': %w", fileName, err)
+	}
+	// Never make a file larger, e.g. when it was already minified.
+	if buf.Len() >= len(content) {
+		return content, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// MinifyFile minifies the file at filePath in place and records the result in stats.
+func MinifyFile(filePath string, stats *MinifyStats) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s' for minification: %w", filePath, err)
+	}
+	minified, err := MinifyContent(filePath, content)
+	if err != nil {
+		return err
+	}
+	if len(minified) < len(content) {
+		if err := os.WriteFile(filePath, minified, 0644); err != nil {
+			return fmt.Errorf("failed to write minified '%s': %w", filePath, err)
+		}
+	}
+	stats.Add(len(content), len(minified))
+	return nil
+}
+
+// MinifyOutput minifies every HTML, CSS and JavaScript file in the output directory.
+// Paths in skip (relative to the output directory, slash-separated) and vendored
+// libraries are left untouched, as they are either already minified or covered by
+// integrity hashes. Files that fail to minify are kept as-is if ignoreErrors is true.
+func MinifyOutput(outputDirectory string, skip map[string]bool, ignoreErrors bool, stats *MinifyStats) error {
+	return filepath.WalkDir(outputDirectory, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, relErr := filepath.Rel(outputDirectory, p)
+		if relErr != nil {
+			return relErr
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel == VendorOutputDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ok := minifyMediaTypes[strings.ToLower(filepath.Ext(p))]; !ok || skip[rel] {
+			return nil
+		}
+		if err := MinifyFile(p, stats); err != nil {
+			if !ignoreErrors {
+				return err
+			}
+			log.Printf("Warning: %v", err)
+		}
+		return nil
+	})
+}
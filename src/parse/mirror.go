@@ -0,0 +1,341 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/k3a/html2text"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"golang.org/x/net/html"
+)
+
+// Machine-readable site summaries written with -markdown (see https://llmstxt.org).
+const (
+	LlmsTxtName     = "llms.txt"
+	LlmsFullTxtName = "llms-full.txt"
+)
+
+// stripFrontmatter returns Markdown source without its leading YAML (---) or TOML (+++)
+// frontmatter block.
+func stripFrontmatter(source []byte) []byte {
+	rest := bytes.TrimPrefix(source, []byte("\ufeff"))
+	firstLine, rest, ok := bytes.Cut(rest, []byte("\n"))
+	delimiter := string(bytes.TrimSpace(firstLine))
+	if !ok || (delimiter != "---" && delimiter != "+++") {
+		return source
+	}
+	for len(rest) > 0 {
+		var line []byte
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+		if string(bytes.TrimSpace(line)) == delimiter {
+			return rest
+		}
+	}
+	return source
+}
+
+// absoluteLink returns the absolute URL of a link found in the source of an article:
+// links to other articles point to their pages, local resources to their copies next to
+// the article's page, and other relative links to the site. External links and same-page
+// anchors are returned unchanged.
+func absoluteLink(destination string, r linkResolver) string {
+	u, err := url.Parse(strings.TrimSpace(destination))
+	if err != nil || u.IsAbs() || u.Host != "" {
+		return destination
+	}
+	sitePath, target, inSite := r.resolve(u)
+	switch {
+	case !inSite:
+		return destination
+	case target != "":
+		if u.Fragment != "" && !strings.Contains(target, "#") {
+			target += "#" + u.EscapedFragment()
+		}
+		return target
+	}
+	if cleanPath, ok := localResourcePath(destination); ok {
+		// Resources are copied relative to the article's page, even root-relative ones.
+		sitePath = path.Join(r.outputDir, cleanPath)
+	} else if strings.HasSuffix(u.Path, "/") && sitePath != "" {
+		sitePath += "/"
+	}
+	u.Path = "/" + sitePath
+	return r.settings.BaseUrl + u.RequestURI() + fragmentSuffix(u)
+}
+
+// wikilinkMarkdown returns the Markdown link or image standing for a parsed wikilink or
+// embed, to its absolute URL (see absoluteLink).
+func wikilinkMarkdown(n ast.Node, r linkResolver) string {
+	var label strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if s, ok := c.(*ast.String); ok {
+			label.Write(s.Value)
+		}
+	}
+	switch n := n.(type) {
+	case *ast.Image:
+		return "![" + label.String() + "](" + absoluteLink(string(n.Destination), r) + ")"
+	case *ast.Link:
+		return "[" + label.String() + "](" + absoluteLink(string(n.Destination), r) + ")"
+	}
+	return label.String()
+}
+
+// byteRange is the range [start, stop) of a source file.
+type byteRange struct {
+	start, stop int
+}
+
+// mergeRanges returns ranges sorted and merged, less the bytes of holes.
+func mergeRanges(ranges []byteRange, holes []byteRange) []byteRange {
+	slices.SortFunc(ranges, func(a, b byteRange) int { return a.start - b.start })
+	var merged []byteRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.start <= merged[n-1].stop {
+			merged[n-1].stop = max(merged[n-1].stop, r.stop)
+		} else if r.start < r.stop {
+			merged = append(merged, r)
+		}
+	}
+	for _, hole := range holes {
+		var rest []byteRange
+		for _, r := range merged {
+			if hole.stop <= r.start || r.stop <= hole.start {
+				rest = append(rest, r)
+				continue
+			}
+			if r.start < hole.start {
+				rest = append(rest, byteRange{r.start, hole.start})
+			}
+			if hole.stop < r.stop {
+				rest = append(rest, byteRange{hole.stop, r.stop})
+			}
+		}
+		merged = rest
+	}
+	return merged
+}
+
+// segmentRanges returns the ranges of segments.
+func segmentRanges(segments *text.Segments) []byteRange {
+	ranges := make([]byteRange, segments.Len())
+	for i := range ranges {
+		segment := segments.At(i)
+		ranges[i] = byteRange{segment.Start, segment.Stop}
+	}
+	return ranges
+}
+
+// MarkdownMirror returns the Markdown source of article without its frontmatter, with
+// relative links and images, including those of inline HTML, made absolute (see
+// absoluteLink), so the text can be read on its own. Links to other articles are looked
+// up in targets (see ArticleLinkKeys). A heading with the title is added unless the
+// source starts with one.
+//
+// Destinations are only rewritten in the lines of the blocks holding links or images,
+// less their code spans, in HTML, and outside blocks, where goldmark leaves the link
+// reference definitions: code is kept as written.
+func MarkdownMirror(article Article, targets map[string]string, settings Settings) (string, error) {
+	source, err := os.ReadFile(article.OriginalPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Markdown file '%s': %w", article.OriginalPath, err)
+	}
+	pc := newParserContext(article.OriginalPath, settings)
+	doc := MarkdownFor(settings).Parser().Parse(text.NewReader(source), parser.WithContext(pc))
+	wikilinks := vaultContextOf(pc).wikilinks
+
+	var destinations []string
+	var ranges, blocks, codeSpans []byteRange
+	linkBlocks := map[ast.Node]bool{}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if n.Type() == ast.TypeBlock {
+			blocks = append(blocks, segmentRanges(n.Lines())...)
+		}
+		// The link or image n is in the lines of its block.
+		addLink := func(destination []byte) {
+			destinations = append(destinations, string(destination))
+			block := n.Parent()
+			for block != nil && block.Type() != ast.TypeBlock {
+				block = block.Parent()
+			}
+			if block != nil && !linkBlocks[block] {
+				linkBlocks[block] = true
+				ranges = append(ranges, segmentRanges(block.Lines())...)
+			}
+		}
+		var raw []byte
+		switch n := n.(type) {
+		case *ast.Link:
+			addLink(n.Destination)
+		case *ast.Image:
+			addLink(n.Destination)
+		case *ast.CodeSpan:
+			for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+				if t, ok := c.(*ast.Text); ok {
+					codeSpans = append(codeSpans, byteRange{t.Segment.Start, t.Segment.Stop})
+				}
+			}
+		case *ast.RawHTML:
+			ranges = append(ranges, segmentRanges(n.Segments)...)
+			for i := 0; i < n.Segments.Len(); i++ {
+				segment := n.Segments.At(i)
+				raw = append(raw, segment.Value(source)...)
+			}
+		case *ast.HTMLBlock:
+			ranges = append(ranges, segmentRanges(n.Lines())...)
+			for i := 0; i < n.Lines().Len(); i++ {
+				segment := n.Lines().At(i)
+				raw = append(raw, segment.Value(source)...)
+			}
+		}
+		if len(raw) > 0 {
+			if node, err := html.Parse(bytes.NewReader(raw)); err == nil {
+				destinations = append(destinations, ExtractResources(node)...)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	// Outside blocks, after the frontmatter.
+	outside := []byteRange{{len(source) - len(stripFrontmatter(source)), len(source)}}
+	ranges = append(ranges, mergeRanges(outside, mergeRanges(blocks, nil))...)
+	holes := codeSpans
+	for _, w := range wikilinks {
+		holes = append(holes, w.span)
+	}
+	ranges = mergeRanges(ranges, holes)
+
+	resolver := newLinkResolver(article, targets, settings)
+	slices.Sort(destinations)
+	var replacements []func(string) string
+	for _, destination := range slices.Compact(destinations) {
+		absolute := absoluteLink(destination, resolver)
+		if destination == "" || absolute == destination {
+			continue
+		}
+		// Destinations are replaced where Markdown or HTML expects a URL: "](dest",
+		// "]: dest" (reference definitions) and quoted attribute values.
+		re := regexp.MustCompile(`(\]\(<?|\]:[ \t]*<?|=["'])` + regexp.QuoteMeta(destination) + `([\s)>"']|$)`)
+		replacement := "${1}" + strings.ReplaceAll(absolute, "$", "$$") + "${2}"
+		replacements = append(replacements, func(s string) string { return re.ReplaceAllString(s, replacement) })
+	}
+
+	// Wikilinks and embeds, which other readers do not understand, are written as
+	// Markdown links and images.
+	type edit struct {
+		byteRange
+		text string
+	}
+	var edits []edit
+	for _, r := range ranges {
+		chunk := string(source[r.start:r.stop])
+		for _, replace := range replacements {
+			chunk = replace(chunk)
+		}
+		edits = append(edits, edit{r, chunk})
+	}
+	for _, w := range wikilinks {
+		edits = append(edits, edit{w.span, wikilinkMarkdown(w.node, resolver)})
+	}
+	slices.SortFunc(edits, func(a, b edit) int { return a.start - b.start })
+
+	var rewritten strings.Builder
+	last := 0
+	for _, e := range edits {
+		rewritten.Write(source[last:e.start])
+		rewritten.WriteString(e.text)
+		last = e.stop
+	}
+	rewritten.Write(source[last:])
+
+	body := strings.TrimSpace(string(stripFrontmatter([]byte(rewritten.String()))))
+	if !strings.HasPrefix(body, "# ") {
+		body = "# " + article.Title + "\n\n" + body
+	}
+	return body + "\n", nil
+}
+
+// GenerateMarkdownMirrors writes, for every Markdown article, its MarkdownMirror next to
+// its page (e.g. "posts/a/index.md"), and at the site root an llms.txt listing the
+// articles and an llms-full.txt with their full text. HTML articles are listed with
+// their page and plain text. Articles with NoMirror set are left out.
+func GenerateMarkdownMirrors(articles []Article, settings Settings) error {
+	targets := map[string]string{}
+	for _, article := range articles {
+		for _, key := range ArticleLinkKeys(article, settings) {
+			targets[key] = settings.BaseUrl + "/" + article.LinkToSelf
+		}
+	}
+
+	var index, full strings.Builder
+	description := strings.TrimSpace(html2text.HTML2Text(string(settings.DescriptionHTML)))
+	for _, b := range []*strings.Builder{&index, &full} {
+		b.WriteString("# " + settings.Title + "\n\n")
+		if description != "" {
+			b.WriteString("> " + strings.ReplaceAll(description, "\n", " ") + "\n\n")
+		}
+	}
+
+	var posts, pages []string
+	for _, article := range articles {
+		if article.NoMirror {
+			continue
+		}
+		link := settings.BaseUrl + "/" + EncodePathSegments(article.LinkToSelf)
+		var content string
+		if strings.EqualFold(filepath.Ext(article.OriginalPath), ".md") {
+			mirror, err := MarkdownMirror(article, targets, settings)
+			if err != nil {
+				return err
+			}
+			mirrorPath := alternatePath(article, settings, ".md")
+			filePath := filepath.Join(settings.OutputPath, filepath.FromSlash(mirrorPath))
+			if err := os.WriteFile(filePath, []byte(mirror), 0644); err != nil {
+				return fmt.Errorf("error writing Markdown mirror to '%s': %w", filePath, err)
+			}
+			link = settings.BaseUrl + "/" + EncodePathSegments(mirrorPath)
+			content = mirror
+		} else {
+			content = "# " + article.Title + "\n\n" + strings.TrimSpace(article.TextContent) + "\n"
+		}
+
+		entry := "- [" + article.Title + "](" + link + ")"
+		if article.Description != "" {
+			entry += ": " + article.Description
+		}
+		if slices.Contains(article.Tags, "PAGE") {
+			pages = append(pages, entry)
+		} else {
+			posts = append(posts, entry)
+		}
+		fmt.Fprintf(&full, "---\n\nSource: %s/%s\nCreated: %s\n\n%s\n", settings.BaseUrl, EncodePathSegments(article.LinkToSelf), article.Created.Format("2006-01-02"), content)
+	}
+
+	for _, section := range []struct {
+		title   string
+		entries []string
+	}{{"Posts", posts}, {"Pages", pages}} {
+		if len(section.entries) > 0 {
+			index.WriteString("## " + section.title + "\n\n" + strings.Join(section.entries, "\n") + "\n\n")
+		}
+	}
+
+	for name, content := range map[string]string{LlmsTxtName: index.String(), LlmsFullTxtName: full.String()} {
+		filePath := filepath.Join(settings.OutputPath, name)
+		if err := os.WriteFile(filePath, []byte(strings.TrimSpace(content)+"\n"), 0644); err != nil {
+			return fmt.Errorf("error writing '%s': %w", filePath, err)
+		}
+	}
+	return nil
+}
@@ -40,14 +40,38 @@ type Settings struct {
 	DoNotRemoveDateFromPaths  bool
 	DoNotRemoveDateFromTitles bool
 	OpenInNewTab              bool
-	BaseUrl                   string
+	BaseUrl                   string // Public URL of the site, including BasePath
+	BasePath                  string // Subpath the site is served under (e.g. "/blog"), empty at the root
 	ShareButtons              []ShareButton
 	Sort                      SortOrder
 	HighlightTheme            string
 	Port                      string
 	ForceOverwrite            bool
 	IgnoreErrors              bool
-	BuildVersion              string
+	RenderMathML              bool
+	Obsidian                  bool // Parse Obsidian wikilinks, embeds, callouts and inline tags
+	Offline                   bool
+	Portable                  bool // Output works from file:// URLs: relative links only, no fetch()
+	SRI                       bool
+	CSPMode                   string
+	Minify                    bool
+	Precompress               bool
+	Book                      bool   // Also write BookPageName, all articles on one printable page
+	Gemini                    bool   // Also write a Gemini capsule into GeminiDirName
+	GeminiUrl                 string // Public gemini:// URL of the capsule
+	Markdown                  bool   // Also write Markdown mirrors of the articles, LlmsTxtName and LlmsFullTxtName
+	API                       bool   // Also write a JSON API into APIDirName
+	APIPageSize               int    // Posts per page of the API's post lists
+	RelatedCount              int    // Related posts ranked for each article, besides pinned ones
+	PrecompressMinSize        int
+	HostingTargets            []string
+	RedirectsCSVPath          string
+	Permalink                 string            // Global permalink pattern, e.g. "/:year/:month/:slug/"
+	DirectoryPermalinks       map[string]string // Permalink patterns keyed by folder relative to InputPath
+	Integrity                 map[string]string // SRI values keyed by output-relative path
+	AssetManifest             map[string]string // Logical asset names mapped to fingerprinted names
+	Vault                     *Vault            // Index of the input directory for links between files; set by the build with Obsidian
+	DescriptionNeedsMathJax   bool
 
 	// AuthorName is used in meta tags and structured data as the article author.
 	AuthorName string
@@ -81,4 +105,23 @@ type Article struct {
 	LinkToSave   string
 	ExternalLink string
 	CanonicalUrl string
+	NeedsMathJax bool         // True if the page contains math that must be typeset client-side
+	Aliases      []string     // Former site-root-relative paths that redirect to this article
+	NoMirror     bool         // Kept out of the Markdown mirrors and llms.txt ("mirror: false")
+	Links        []string     // LinkToSelf of the other articles this one links to (see LinkArticles)
+	Backlinks    []ArticleRef // Articles linking to this one (see LinkArticles)
+	RelatedPins  []string     // Articles listed in the "related" frontmatter, as links, titles or [[wikilinks]]
+	Related      []ArticleRef // Pinned and most similar articles (see RelateArticles)
+	Series       string       // Name of the series the article is a part of ("series" frontmatter)
+	SeriesOrder  int          // Position in the series ("series_order" frontmatter), or 0 to order by date
+	SeriesNav    *SeriesNav   // The series and its other parts (see GroupSeries)
+	Prev         *ArticleRef  // Article listed before this one on the index (see LinkNeighbors)
+	Next         *ArticleRef  // Article listed after this one on the index (see LinkNeighbors)
+	Breadcrumbs  []Breadcrumb // Trail from the home page through the source folders (see SetBreadcrumbs)
+}
+
+// ArticleRef names another article in the templates of an article's page.
+type ArticleRef struct {
+	Title      string
+	LinkToSelf string
 }
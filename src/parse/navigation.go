@@ -0,0 +1,100 @@
+package parse
+
+import (
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Breadcrumb is a step of the trail from the home page to an article, through the
+// folders of its source file. The first step, the home page, is given in the
+// BreadcrumbList JSON-LD as the site root.
+type Breadcrumb struct {
+	Name       string
+	LinkToSelf string // Page of the step, or "" for a folder without one
+	Position   int    // Position in the BreadcrumbList JSON-LD, or 0 if left out for lack of a page
+}
+
+// LinkNeighbors sets the Prev and Next articles of every listed article (pages, tagged
+// PAGE, are not listed) to its neighbors in the order of articles, sorted by order as on
+// the index page. With the newest-first date orders, the neighbors are taken in reverse,
+// so that Prev is the older article.
+func LinkNeighbors(articles []Article, order SortOrder) {
+	var listed []int
+	for i := range articles {
+		articles[i].Prev, articles[i].Next = nil, nil
+		if !slices.Contains(articles[i].Tags, "PAGE") {
+			listed = append(listed, i)
+		}
+	}
+	if order == SortDateCreated || order == SortDateUpdated {
+		slices.Reverse(listed)
+	}
+	for n, i := range listed {
+		if n > 0 {
+			prev := articles[listed[n-1]]
+			articles[i].Prev = &ArticleRef{Title: prev.Title, LinkToSelf: prev.LinkToSelf}
+		}
+		if n < len(listed)-1 {
+			next := articles[listed[n+1]]
+			articles[i].Next = &ArticleRef{Title: next.Title, LinkToSelf: next.LinkToSelf}
+		}
+	}
+}
+
+// folderPageSources returns the source files, relative to the input directory, whose
+// page stands for the folder dir: "dir.md" next to it, or "dir/index.md" and
+// "dir/<dir>.md" (a folder note) inside it, or their HTML counterparts.
+func folderPageSources(dir string) []string {
+	var sources []string
+	for _, ext := range []string{".md", ".html"} {
+		sources = append(sources, dir+ext, dir+"/index"+ext, dir+"/"+path.Base(dir)+ext)
+	}
+	return sources
+}
+
+// SetBreadcrumbs sets the Breadcrumbs of every article: the home page, the folders of its
+// source file, linked to their pages if they have one (see folderPageSources), and the
+// article itself.
+func SetBreadcrumbs(articles []Article, settings Settings) {
+	pages := map[string]string{}
+	for _, article := range articles {
+		if rel, err := filepath.Rel(settings.InputPath, article.OriginalPath); err == nil {
+			pages[filepath.ToSlash(rel)] = article.LinkToSelf
+		}
+	}
+	for i, article := range articles {
+		trail := []Breadcrumb{{Name: settings.Title, LinkToSelf: settings.IndexName}}
+		if rel, err := filepath.Rel(settings.InputPath, article.OriginalPath); err == nil {
+			dir := ""
+			for _, folder := range strings.Split(path.Dir(filepath.ToSlash(rel)), "/") {
+				if folder == "." {
+					continue
+				}
+				dir = path.Join(dir, folder)
+				crumb := Breadcrumb{Name: strings.Trim(RemoveDateFromPath(folder), "-_ ")}
+				if crumb.Name == "" {
+					crumb.Name = folder
+				}
+				for _, source := range folderPageSources(dir) {
+					if page, ok := pages[source]; ok && page != article.LinkToSelf {
+						crumb.LinkToSelf = page
+						break
+					}
+				}
+				trail = append(trail, crumb)
+			}
+		}
+		trail = append(trail, Breadcrumb{Name: article.Title, LinkToSelf: article.LinkToSelf})
+
+		position := 0
+		for j := range trail {
+			if trail[j].LinkToSelf != "" {
+				position++
+				trail[j].Position = position
+			}
+		}
+		articles[i].Breadcrumbs = trail
+	}
+}
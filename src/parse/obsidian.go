@@ -0,0 +1,333 @@
+package parse
+
+import (
+	"bytes"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// obsidianExtender adds the Markdown extensions of Obsidian vaults: [[wikilinks]] and
+// ![[embeds]] resolved through the Vault, "> [!note]" callouts and inline #tags.
+type obsidianExtender struct{}
+
+// Extend registers the inline parsers, AST transformers and callout renderer.
+func (e *obsidianExtender) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(
+			util.Prioritized(&wikilinkParser{}, 199), // Before the link parser
+			util.Prioritized(&hashtagParser{}, 500),
+		),
+		parser.WithASTTransformers(
+			util.Prioritized(&vaultLinkTransformer{}, 500),
+			util.Prioritized(&calloutTransformer{}, 500),
+		),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&calloutRenderer{}, 500),
+	))
+}
+
+// imageExtensions are the file types that ![[embeds]] show as images.
+var imageExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true,
+	".svg": true, ".avif": true, ".bmp": true,
+}
+
+// regexEmbedSize matches the "|300" or "|300x200" size of an image embed.
+var regexEmbedSize = regexp.MustCompile(`^(\d+)(?:x(\d+))?$`)
+
+// wikilinkParser parses [[Note]], [[Note#Heading|alias]] and ![[file]]. Links to notes
+// missing from the vault are left as written.
+type wikilinkParser struct{}
+
+// Trigger implements parser.InlineParser.
+func (p *wikilinkParser) Trigger() []byte {
+	return []byte{'!', '['}
+}
+
+// Parse implements parser.InlineParser.
+func (p *wikilinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	embed := bytes.HasPrefix(line, []byte("![["))
+	if !embed && !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	start := 2
+	if embed {
+		start = 3
+	}
+	end := bytes.Index(line[start:], []byte("]]"))
+	if end <= 0 {
+		return nil
+	}
+	inner := string(line[start : start+end])
+	if strings.ContainsAny(inner, "[]\n") {
+		return nil
+	}
+
+	_, segment := block.Position()
+	span := byteRange{segment.Start, segment.Start + start + end + 2}
+
+	target, label, hasLabel := strings.Cut(inner, "|")
+	target, heading, _ := strings.Cut(strings.TrimSpace(target), "#")
+	target = strings.TrimSpace(target)
+	heading = strings.TrimSpace(heading)
+	label = strings.TrimSpace(label)
+
+	vc := vaultContextOf(pc)
+	ext := strings.ToLower(path.Ext(target))
+	if embed && target != "" && ext != "" && ext != ".md" {
+		block.Advance(start + end + 2)
+		node := vc.embedFile(target, label, hasLabel)
+		vc.wikilinks = append(vc.wikilinks, wikilink{span, node})
+		return node
+	}
+	if !hasLabel || label == "" {
+		label = strings.TrimSuffix(target, path.Ext(target))
+		if i := strings.LastIndex(label, "/"); i >= 0 {
+			label = label[i+1:]
+		}
+		if heading != "" {
+			label = strings.TrimSpace(label + " > " + heading)
+			label = strings.TrimPrefix(label, "> ")
+		}
+	}
+
+	destination := ""
+	if target == "" && heading != "" {
+		destination = "#"
+	} else if vc.vault != nil {
+		name := strings.TrimSuffix(target, path.Ext(target))
+		if found, ok := vc.vault.find(vc.vault.notes, name, path.Dir(vc.source)); ok {
+			destination = vc.vault.pageLink(vc.source, found)
+		}
+	}
+	if destination == "" {
+		return nil // Left as written
+	}
+	block.Advance(start + end + 2)
+	if heading != "" {
+		destination = strings.TrimSuffix(destination, "#") + "#" + headingID(heading)
+	}
+	link := ast.NewLink()
+	link.Destination = []byte(destination)
+	link.AppendChild(link, ast.NewString([]byte(label)))
+	vc.wikilinks = append(vc.wikilinks, wikilink{span, link})
+	return link
+}
+
+// embedFile returns the node for ![[target|label]] naming a file other than a note: an
+// image, sized if label is "300" or "300x200", or else a link to the file.
+func (vc *vaultContext) embedFile(target string, label string, hasLabel bool) ast.Node {
+	destination := EncodePathSegments(target)
+	if vc.vault != nil {
+		if found, ok := vc.vault.find(vc.vault.files, target, path.Dir(vc.source)); ok {
+			destination = vc.vault.fileLink(vc.source, found)
+		}
+	}
+	link := ast.NewLink()
+	link.Destination = []byte(destination)
+	name := path.Base(target)
+	if !imageExtensions[strings.ToLower(path.Ext(target))] {
+		if !hasLabel || label == "" {
+			label = name
+		}
+		link.AppendChild(link, ast.NewString([]byte(label)))
+		return link
+	}
+	image := ast.NewImage(link)
+	if size := regexEmbedSize.FindStringSubmatch(label); size != nil {
+		image.SetAttributeString("width", []byte(size[1]))
+		if size[2] != "" {
+			image.SetAttributeString("height", []byte(size[2]))
+		}
+		label = ""
+	}
+	if label == "" {
+		label = strings.TrimSuffix(name, path.Ext(name))
+	}
+	image.AppendChild(image, ast.NewString([]byte(label)))
+	return image
+}
+
+// headingID returns the id that parser.WithAutoHeadingID gives the first heading with
+// the text heading.
+func headingID(heading string) string {
+	var id strings.Builder
+	for _, r := range strings.TrimSpace(heading) {
+		switch {
+		case r >= utf8.RuneSelf:
+		case 'A' <= r && r <= 'Z':
+			id.WriteRune(r + 'a' - 'A')
+		case 'a' <= r && r <= 'z', '0' <= r && r <= '9':
+			id.WriteRune(r)
+		case r == ' ' || r == '\t' || r == '-' || r == '_':
+			id.WriteByte('-')
+		}
+	}
+	if id.Len() == 0 {
+		return "heading"
+	}
+	return id.String()
+}
+
+// hashtagParser parses inline #tags, which must follow a space or start a line and may
+// hold letters, digits, "_", "-" and "/", but not only digits. The tags are collected in
+// the vaultContext for MarkdownFile.
+type hashtagParser struct{}
+
+// Trigger implements parser.InlineParser.
+func (p *hashtagParser) Trigger() []byte {
+	return []byte{'#'}
+}
+
+// Parse implements parser.InlineParser.
+func (p *hashtagParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if previous := block.PrecendingCharacter(); previous != '\n' && !unicode.IsSpace(previous) {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	tag := []rune{}
+	digitsOnly := true
+	for _, r := range string(line[1:]) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '/' {
+			break
+		}
+		if !unicode.IsDigit(r) {
+			digitsOnly = false
+		}
+		tag = append(tag, r)
+	}
+	name := strings.TrimRight(string(tag), "/")
+	if name == "" || digitsOnly {
+		return nil
+	}
+	block.Advance(1 + len(name))
+	vc := vaultContextOf(pc)
+	vc.tags = append(vc.tags, name)
+	s := ast.NewString([]byte(`<span class="hashtag">#` + html.EscapeString(name) + `</span>`))
+	s.SetCode(true)
+	return s
+}
+
+// regexCallout matches the first line of a callout: "[!type]", an optional "+" or "-"
+// making it foldable, open or closed, and an optional title.
+var regexCallout = regexp.MustCompile(`^\[!(\w[\w-]*)\]([+-]?)[ \t]*(.*)$`)
+
+// KindCallout is the ast.NodeKind of callouts.
+var KindCallout = ast.NewNodeKind("Callout")
+
+// calloutNode is a blockquote that starts with "[!type] Title".
+type calloutNode struct {
+	ast.BaseBlock
+	CalloutType string // Lowercased, e.g. "note" or "warning"
+	Title       string
+	Fold        string // "", or "+" or "-" for a callout open or closed by default
+}
+
+// Kind implements ast.Node.
+func (n *calloutNode) Kind() ast.NodeKind {
+	return KindCallout
+}
+
+// Dump implements ast.Node.
+func (n *calloutNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"CalloutType": n.CalloutType, "Title": n.Title, "Fold": n.Fold}, nil)
+}
+
+// calloutTransformer turns blockquotes whose first line is "[!type] Title" into callouts.
+type calloutTransformer struct{}
+
+// Transform implements parser.ASTTransformer.
+func (t *calloutTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var quotes []*ast.Blockquote
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if quote, ok := n.(*ast.Blockquote); ok && entering {
+			quotes = append(quotes, quote)
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, quote := range quotes {
+		paragraph, ok := quote.FirstChild().(*ast.Paragraph)
+		if !ok || paragraph.Lines().Len() == 0 {
+			continue
+		}
+		first := paragraph.Lines().At(0)
+		match := regexCallout.FindSubmatch(bytes.TrimRight(first.Value(source), " \t\r\n"))
+		if match == nil {
+			continue
+		}
+		callout := &calloutNode{
+			CalloutType: strings.ToLower(string(match[1])),
+			Fold:        string(match[2]),
+			Title:       strings.TrimSpace(string(match[3])),
+		}
+		if callout.Title == "" {
+			callout.Title = strings.ToUpper(callout.CalloutType[:1]) + strings.ReplaceAll(callout.CalloutType[1:], "-", " ")
+		}
+
+		// Drop the inlines of the first line, up to its line break.
+		for c := paragraph.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			paragraph.RemoveChild(paragraph, c)
+			if t, ok := c.(*ast.Text); ok && (t.SoftLineBreak() || t.HardLineBreak()) {
+				break
+			}
+			c = next
+		}
+		if !paragraph.HasChildren() {
+			quote.RemoveChild(quote, paragraph)
+		}
+
+		for c := quote.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			callout.AppendChild(callout, c)
+			c = next
+		}
+		quote.Parent().ReplaceChild(quote.Parent(), quote, callout)
+	}
+}
+
+// calloutRenderer renders callouts as asides, or as details elements if foldable.
+type calloutRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (r *calloutRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindCallout, r.renderCallout)
+}
+
+func (r *calloutRenderer) renderCallout(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*calloutNode)
+	class := `class="callout callout-` + html.EscapeString(n.CalloutType) + `"`
+	title := html.EscapeString(n.Title)
+	if n.Fold == "" {
+		if entering {
+			_, _ = w.WriteString("<aside " + class + ">\n<p class=\"callout-title\">" + title + "</p>\n")
+		} else {
+			_, _ = w.WriteString("</aside>\n")
+		}
+		return ast.WalkContinue, nil
+	}
+	if entering {
+		open := ""
+		if n.Fold == "+" {
+			open = " open"
+		}
+		_, _ = w.WriteString("<details " + class + open + ">\n<summary class=\"callout-title\">" + title + "</summary>\n")
+	} else {
+		_, _ = w.WriteString("</details>\n")
+	}
+	return ast.WalkContinue, nil
+}
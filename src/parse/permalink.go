@@ -0,0 +1,109 @@
+package parse
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Placeholders supported in permalink patterns.
+const (
+	PermalinkYear    = ":year"    // Four-digit year of the creation date
+	PermalinkMonth   = ":month"   // Two-digit month of the creation date
+	PermalinkDay     = ":day"     // Two-digit day of the creation date
+	PermalinkSlug    = ":slug"    // File name without extension (and without date, unless kept)
+	PermalinkSection = ":section" // First folder of the source path, empty at the root
+	PermalinkPath    = ":path"    // Full folder of the source path, empty at the root
+)
+
+var permalinkPlaceholders = []string{PermalinkYear, PermalinkMonth, PermalinkDay, PermalinkSlug, PermalinkSection, PermalinkPath}
+
+// regexPermalinkPlaceholder finds placeholders in a permalink pattern.
+var regexPermalinkPlaceholder = regexp.MustCompile(`:[a-z]+`)
+
+// ValidatePermalink checks that a permalink pattern only uses known placeholders and
+// contains :slug, without which different articles would share the same URL.
+func ValidatePermalink(pattern string) error {
+	for _, placeholder := range regexPermalinkPlaceholder.FindAllString(pattern, -1) {
+		if !slices.Contains(permalinkPlaceholders, placeholder) {
+			return fmt.Errorf("unknown placeholder '%s' in permalink '%s' (supported: %s)", placeholder, pattern, strings.Join(permalinkPlaceholders, ", "))
+		}
+	}
+	if !strings.Contains(pattern, PermalinkSlug) {
+		return fmt.Errorf("permalink '%s' must contain %s", pattern, PermalinkSlug)
+	}
+	return nil
+}
+
+// PermalinkPatternFor returns the pattern that applies to a content file, relative to
+// the input directory: the one configured for its closest parent folder, else the
+// global pattern. An empty result means the default, path-based layout.
+func PermalinkPatternFor(relativeInputPath string, settings Settings) string {
+	dir := path.Dir(filepath.ToSlash(relativeInputPath))
+	for dir != "." && dir != "/" && dir != "" {
+		if pattern, ok := settings.DirectoryPermalinks[dir]; ok {
+			return pattern
+		}
+		dir = path.Dir(dir)
+	}
+	if pattern, ok := settings.DirectoryPermalinks["."]; ok {
+		return pattern
+	}
+	return settings.Permalink
+}
+
+// ExpandPermalink computes the output path, relative to the output directory, of a
+// content file for the given pattern. Patterns ending in a file extension produce that
+// file ("ugly" URLs); all others produce a folder containing settings.IndexName.
+func ExpandPermalink(pattern string, relativeInputPath string, created time.Time, settings Settings) string {
+	rel := filepath.ToSlash(relativeInputPath)
+	dir := path.Dir(rel)
+	if dir == "." {
+		dir = ""
+	}
+	slug := strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+	if !settings.DoNotRemoveDateFromPaths {
+		if dateless := RemoveDateFromPath(slug); dateless != "" {
+			slug = dateless
+		}
+		dir = RemoveDateFromPath(dir)
+	}
+	section, _, _ := strings.Cut(dir, "/")
+
+	expanded := strings.NewReplacer(
+		PermalinkYear, fmt.Sprintf("%04d", created.Year()),
+		PermalinkMonth, fmt.Sprintf("%02d", int(created.Month())),
+		PermalinkDay, fmt.Sprintf("%02d", created.Day()),
+		PermalinkSlug, slug,
+		PermalinkSection, section,
+		PermalinkPath, dir,
+	).Replace(pattern)
+
+	// The extension is taken from the pattern, as slugs may contain dots (e.g. "v0.1.5").
+	isFile := !strings.HasSuffix(pattern, "/") && path.Ext(pattern) != ""
+	expanded = strings.TrimPrefix(path.Clean("/"+expanded), "/")
+	if !isFile {
+		expanded = path.Join(expanded, settings.IndexName)
+	}
+	return filepath.FromSlash(expanded)
+}
+
+// CheckPageCollisions returns an error naming the source files of two articles written
+// to the same page, as permalink patterns without enough placeholders can do. Pages are
+// compared case-insensitively, as on the file systems of Windows and macOS.
+func CheckPageCollisions(articles []Article) error {
+	sources := map[string]string{}
+	for _, article := range articles {
+		key := strings.ToLower(article.LinkToSelf)
+		if other, ok := sources[key]; ok {
+			first, second := min(other, article.OriginalPath), max(other, article.OriginalPath)
+			return fmt.Errorf("'%s' and '%s' are both written to '%s'", first, second, article.LinkToSelf)
+		}
+		sources[key] = article.OriginalPath
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckPageCollisions(t *testing.T) {
+	settings := Settings{IndexName: "index.html"}
+	created := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	page := func(pattern string, source string) Article {
+		return Article{OriginalPath: source, LinkToSelf: ExpandPermalink(pattern, source, created, settings)}
+	}
+
+	tests := []struct {
+		name     string
+		articles []Article
+		want     string // Substring of the error, or "" for none
+	}{
+		{
+			"distinct pages",
+			[]Article{page("/posts/:path/:slug/", "a/intro.md"), page("/posts/:path/:slug/", "b/intro.md")},
+			"",
+		},
+		{
+			"same slug in different folders",
+			[]Article{page("/posts/:slug.html", "b/intro.md"), page("/posts/:slug.html", "a/intro.md")},
+			"'a/intro.md' and 'b/intro.md' are both written to 'posts/intro.html'",
+		},
+		{
+			"pages differing in case",
+			[]Article{{OriginalPath: "x.md", LinkToSelf: "Post/index.html"}, {OriginalPath: "y.md", LinkToSelf: "post/index.html"}},
+			"'x.md' and 'y.md'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPageCollisions(tt.articles)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("CheckPageCollisions returned error: %v", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("CheckPageCollisions returned no error, want one containing %q", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("CheckPageCollisions error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package parse
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// NormalizeRedirectPath turns an alias or redirect source into a site-root-relative path
+// with a leading slash (e.g. "old/post/" -> "/old/post/"). Absolute URLs are returned unchanged.
+func NormalizeRedirectPath(p string) string {
+	p = strings.TrimSpace(p)
+	if p == "" || isAbsoluteURL(p) {
+		return p
+	}
+	trailingSlash := strings.HasSuffix(p, "/")
+	p = path.Clean("/" + filepath.ToSlash(p))
+	if trailingSlash && p != "/" {
+		p += "/"
+	}
+	return p
+}
+
+// isAbsoluteURL reports whether s carries a scheme or is protocol-relative.
+func isAbsoluteURL(s string) bool {
+	lower := strings.ToLower(s)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "//")
+}
+
+// ArticleRedirects returns a permanent redirect from every alias of every article to the article.
+// Aliases that match the article's own path, e.g. an imported permalink that the site's
+// permalink pattern reproduces, are skipped.
+func ArticleRedirects(articles []Article, settings Settings) []Redirect {
+	var redirects []Redirect
+	for _, article := range articles {
+		self := "/" + article.LinkToSelf
+		selfDir, isIndex := strings.CutSuffix(self, "/"+settings.IndexName)
+		for _, alias := range article.Aliases {
+			from := NormalizeRedirectPath(alias)
+			if from == "" || isAbsoluteURL(from) || from == self || (isIndex && strings.TrimSuffix(from, "/") == selfDir) {
+				continue
+			}
+			redirects = append(redirects, Redirect{From: from, To: "/" + article.LinkToSelf, Status: http.StatusMovedPermanently})
+		}
+	}
+	return redirects
+}
+
+// LoadRedirectsCSV reads redirects from a CSV file with the columns "from,to[,status]".
+// A header row starting with "from" and lines starting with '#' are skipped.
+// The status defaults to 301.
+func LoadRedirectsCSV(csvPath string) ([]Redirect, error) {
+	f, err := os.Open(csvPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open redirects file '%s': %w", csvPath, err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var redirects []Redirect
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redirects file '%s': %w", csvPath, err)
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("redirects file '%s', record %d: expected 'from,to[,status]'", csvPath, line)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "from") {
+			continue
+		}
+		redirect := Redirect{
+			From:   NormalizeRedirectPath(record[0]),
+			To:     strings.TrimSpace(record[1]),
+			Status: http.StatusMovedPermanently,
+		}
+		if !isAbsoluteURL(redirect.To) {
+			redirect.To = NormalizeRedirectPath(redirect.To)
+		}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			status, err := strconv.Atoi(strings.TrimSpace(record[2]))
+			if err != nil || status < 300 || status > 399 {
+				return nil, fmt.Errorf("redirects file '%s', record %d: invalid status '%s'", csvPath, line, record[2])
+			}
+			redirect.Status = status
+		}
+		if redirect.From == "" || redirect.To == "" || isAbsoluteURL(redirect.From) {
+			return nil, fmt.Errorf("redirects file '%s', record %d: 'from' must be a site path and 'to' must not be empty", csvPath, line)
+		}
+		redirects = append(redirects, redirect)
+	}
+	return redirects, nil
+}
+
+// redirectStubPath returns the output-relative file that serves a redirect source:
+// directory-like paths get an index file, paths with an extension are used as-is.
+func redirectStubPath(from string, indexName string) string {
+	from = strings.TrimPrefix(from, "/")
+	if from == "" || strings.HasSuffix(from, "/") || path.Ext(from) == "" {
+		return path.Join(from, indexName)
+	}
+	return from
+}
+
+// RedirectPage renders a minimal HTML page that forwards visitors to target through a
+// meta refresh, for hosts that do not process redirect rules. canonical is the absolute
+// URL of the destination, so search engines transfer the old page's ranking to it.
+func RedirectPage(target string, canonical string) string {
+	target = html.EscapeString(target)
+	canonical = html.EscapeString(canonical)
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Redirecting&hellip;</title>
+    <meta name="robots" content="noindex">
+    <meta http-equiv="refresh" content="0; url=%s">
+    <link rel="canonical" href="%s">
+</head>
+<body>
+    <p>This page has moved to <a href="%s">%s</a>.</p>
+</body>
+</html>
+`, target, canonical, target, canonical)
+}
+
+// WriteRedirectPages writes a RedirectPage at the source path of every redirect.
+// Existing files, such as real pages, are never overwritten.
+func WriteRedirectPages(redirects []Redirect, settings Settings) error {
+	for _, redirect := range redirects {
+		stub := redirectStubPath(redirect.From, settings.IndexName)
+		destPath := filepath.Join(settings.OutputPath, filepath.FromSlash(stub))
+		if _, err := os.Stat(destPath); err == nil {
+			if !settings.IgnoreErrors {
+				return fmt.Errorf("redirect from '%s' conflicts with existing file '%s'", redirect.From, destPath)
+			}
+			log.Printf("Warning: Skipping redirect from '%s': '%s' already exists", redirect.From, destPath)
+			continue
+		}
+
+		target, canonical := redirect.To, redirect.To
+		if !isAbsoluteURL(redirect.To) {
+			// Relative targets keep the stubs working under any host or subpath.
+			toPath := strings.TrimPrefix(redirect.To, "/")
+			if toPath == "" || strings.HasSuffix(toPath, "/") {
+				toPath += settings.IndexName
+			}
+			target = genRelativeLink(stub, toPath)
+			canonical = settings.BaseUrl + "/" + toPath
+		}
+
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for redirect '%s': %w", destPath, err)
+		}
+		if err := os.WriteFile(destPath, []byte(RedirectPage(target, canonical)), 0644); err != nil {
+			return fmt.Errorf("failed to write redirect page '%s': %w", destPath, err)
+		}
+	}
+	return nil
+}
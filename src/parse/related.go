@@ -0,0 +1,228 @@
+package parse
+
+import (
+	"cmp"
+	"log"
+	"math"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// DefaultRelatedCount is the default number of related posts listed on each article.
+const DefaultRelatedCount = 3
+
+// termVector holds the TF-IDF weights of the words of a text, normalized to length 1.
+type termVector map[string]float64
+
+// textTerms returns the number of occurrences of each word of text, lowercased, leaving
+// out words shorter than three letters.
+func textTerms(text string) map[string]int {
+	terms := map[string]int{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if len([]rune(word)) >= 3 {
+			terms[word]++
+		}
+	}
+	return terms
+}
+
+// termVectors returns the TF-IDF vectors of texts: words that are frequent in a text but
+// rare in the others weigh the most.
+func termVectors(texts []string) []termVector {
+	counts := make([]map[string]int, len(texts))
+	documents := map[string]int{}
+	for i, text := range texts {
+		counts[i] = textTerms(text)
+		for term := range counts[i] {
+			documents[term]++
+		}
+	}
+	vectors := make([]termVector, len(texts))
+	for i, terms := range counts {
+		total := 0
+		for _, n := range terms {
+			total += n
+		}
+		vector := termVector{}
+		norm := 0.0
+		for term, n := range terms {
+			weight := float64(n) / float64(total) * math.Log(float64(len(texts))/float64(documents[term]))
+			if weight > 0 {
+				vector[term] = weight
+				norm += weight * weight
+			}
+		}
+		for term := range vector {
+			vector[term] /= math.Sqrt(norm)
+		}
+		vectors[i] = vector
+	}
+	return vectors
+}
+
+// cosine returns the cosine similarity of two normalized vectors.
+func (v termVector) cosine(other termVector) float64 {
+	if len(other) < len(v) {
+		v, other = other, v
+	}
+	sum := 0.0
+	for term, weight := range v {
+		sum += weight * other[term]
+	}
+	return sum
+}
+
+// tagKey returns the form in which tags are compared, or "" for tags left out of the
+// comparison (the PAGE tag).
+func tagKey(tag string) string {
+	if tag = strings.ToLower(strings.TrimSpace(tag)); tag == "page" {
+		return ""
+	}
+	return tag
+}
+
+// tagWeights returns the inverse document frequency of every tag of articles: tags that
+// every article has, like the name of a folder holding them all, weigh nothing.
+func tagWeights(articles []Article) map[string]float64 {
+	counts := map[string]int{}
+	for _, article := range articles {
+		seen := map[string]bool{}
+		for _, tag := range article.Tags {
+			if key := tagKey(tag); key != "" && !seen[key] {
+				seen[key] = true
+				counts[key]++
+			}
+		}
+	}
+	weights := map[string]float64{}
+	for key, n := range counts {
+		weights[key] = math.Log(float64(len(articles)) / float64(n))
+	}
+	return weights
+}
+
+// sharedTags returns the weighted Jaccard similarity of two tag lists: the weight of the
+// tags they share over the weight of all their tags.
+func sharedTags(a []string, b []string, weights map[string]float64) float64 {
+	set := map[string]int{}
+	for i, tags := range [][]string{a, b} {
+		for _, tag := range tags {
+			if key := tagKey(tag); key != "" {
+				set[key] |= 1 << i
+			}
+		}
+	}
+	shared, total := 0.0, 0.0
+	for key, in := range set {
+		total += weights[key]
+		if in == 3 {
+			shared += weights[key]
+		}
+	}
+	if shared == 0 {
+		return 0
+	}
+	return shared / total
+}
+
+// findPinned returns the index of the article that a "related" frontmatter entry of
+// article names: a link to its source file or page, as in the article's Markdown, its
+// title, or a [[wikilink]] to it.
+func findPinned(pin string, article Article, articles []Article, targets map[string]string, indexes map[string]int, settings Settings) (int, bool) {
+	pin = strings.TrimSpace(pin)
+	if name, ok := strings.CutPrefix(pin, "[["); ok {
+		name, _, _ = strings.Cut(strings.TrimSuffix(name, "]]"), "|")
+		name, _, _ = strings.Cut(name, "#")
+		if settings.Vault != nil {
+			from := ""
+			if rel, err := filepath.Rel(settings.InputPath, article.OriginalPath); err == nil {
+				from = path.Dir(filepath.ToSlash(rel))
+			}
+			if found, ok := settings.Vault.find(settings.Vault.notes, strings.TrimSpace(name), from); ok {
+				i, ok := indexes[targets[sourceLinkPrefix+found]]
+				return i, ok
+			}
+		}
+		pin = strings.TrimSpace(name)
+	}
+	if u, err := url.Parse(pin); err == nil {
+		if _, target, _ := newLinkResolver(article, targets, settings).resolve(u); target != "" {
+			i, ok := indexes[target]
+			return i, ok
+		}
+	}
+	for i, other := range articles {
+		if strings.EqualFold(other.Title, pin) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// RelateArticles sets the Related articles of every article: first the ones pinned in
+// its "related" frontmatter, then up to settings.RelatedCount more, ranked by the rare
+// tags they share and by the TF-IDF similarity of their TextContent. Pages (tagged PAGE)
+// are neither ranked nor given ranked articles.
+func RelateArticles(articles []Article, settings Settings) {
+	targets := map[string]string{}
+	indexes := map[string]int{}
+	texts := make([]string, len(articles))
+	for i, article := range articles {
+		for _, key := range ArticleLinkKeys(article, settings) {
+			targets[key] = article.LinkToSelf
+		}
+		indexes[article.LinkToSelf] = i
+		texts[i] = article.Title + "\n" + article.TextContent
+	}
+	vectors := termVectors(texts)
+	weights := tagWeights(articles)
+
+	related := make([][]ArticleRef, len(articles))
+	for i, article := range articles {
+		chosen := map[int]bool{i: true}
+		for _, pin := range article.RelatedPins {
+			j, ok := findPinned(pin, article, articles, targets, indexes, settings)
+			if !ok {
+				log.Printf("Warning: Related article '%s' of '%s' not found\n", pin, article.OriginalPath)
+				continue
+			}
+			if !chosen[j] {
+				chosen[j] = true
+				related[i] = append(related[i], ArticleRef{Title: articles[j].Title, LinkToSelf: articles[j].LinkToSelf})
+			}
+		}
+		if settings.RelatedCount <= 0 || slices.Contains(article.Tags, "PAGE") {
+			continue
+		}
+
+		type candidate struct {
+			index int
+			score float64
+		}
+		var candidates []candidate
+		for j, other := range articles {
+			if chosen[j] || slices.Contains(other.Tags, "PAGE") {
+				continue
+			}
+			if score := sharedTags(article.Tags, other.Tags, weights) + vectors[i].cosine(vectors[j]); score > 0 {
+				candidates = append(candidates, candidate{j, score})
+			}
+		}
+		slices.SortStableFunc(candidates, func(a, b candidate) int {
+			return cmp.Compare(b.score, a.score)
+		})
+		for _, c := range candidates[:min(settings.RelatedCount, len(candidates))] {
+			related[i] = append(related[i], ArticleRef{Title: articles[c.index].Title, LinkToSelf: articles[c.index].LinkToSelf})
+		}
+	}
+	for i := range articles {
+		articles[i].Related = related[i]
+	}
+}
@@ -0,0 +1,334 @@
+package parse
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Supported values for Settings.CSPMode.
+const (
+	CSPModeNone    = ""
+	CSPModeMeta    = "meta"
+	CSPModeHeaders = "headers"
+	CSPModeBoth    = "both"
+)
+
+// ParseCSPMode validates the value of the -csp flag.
+func ParseCSPMode(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case CSPModeNone, CSPModeMeta, CSPModeHeaders, CSPModeBoth:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unsupported CSP mode: %s", s)
+	}
+}
+
+// CSPInMeta reports whether pages should carry the policy in a <meta http-equiv> tag.
+func (s Settings) CSPInMeta() bool {
+	return s.CSPMode == CSPModeMeta || s.CSPMode == CSPModeBoth
+}
+
+// CSPInHeaders reports whether the policy should be written to a hosting headers file.
+func (s Settings) CSPInHeaders() bool {
+	return s.CSPMode == CSPModeHeaders || s.CSPMode == CSPModeBoth
+}
+
+// ComputeIntegrity returns the Subresource Integrity value (sha384) for content.
+func ComputeIntegrity(content []byte) string {
+	sum := sha512.Sum384(content)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// VendorIntegrity returns the SRI value of the named library: the one recorded by
+// 'go generate', or else that of its embedded copy. The CDN URLs are pinned to the
+// vendored versions, so the value is valid for both.
+func VendorIntegrity(assets fs.FS, name string) (string, error) {
+	if integrity, ok := vendorIntegrity[name]; ok {
+		return integrity, nil
+	}
+	content, err := VendorContent(assets, name)
+	if err != nil {
+		return "", err
+	}
+	return ComputeIntegrity(content), nil
+}
+
+// integrityAttr returns the integrity and crossorigin attributes for a resource
+// registered in settings.Integrity, or an empty string when SRI is disabled or unknown.
+// It is registered as "integrityAttr" in templates.
+func integrityAttr(key string, settings Settings) string {
+	// The crossorigin attribute required by SRI makes browsers refuse file:// resources.
+	if settings.Portable {
+		return ""
+	}
+	return sriAttributes(key, settings)
+}
+
+// vendorIntegrityAttr is integrityAttr for a vendored library referenced by name.
+// It is registered as "vendorIntegrityAttr" in templates.
+func vendorIntegrityAttr(name string, settings Settings) string {
+	lib, err := findVendorLibrary(name)
+	if err != nil {
+		return ""
+	}
+	key := path.Join(VendorOutputDir, lib.File)
+	if settings.Offline {
+		return integrityAttr(key, settings)
+	}
+	// CDN copies are fetched over https, so they keep their integrity in portable builds.
+	return sriAttributes(key, settings)
+}
+
+// sriAttributes formats the integrity and crossorigin attributes for key.
+func sriAttributes(key string, settings Settings) string {
+	if !settings.SRI {
+		return ""
+	}
+	value, ok := settings.Integrity[key]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(` integrity="%s" crossorigin="anonymous"`, value)
+}
+
+// CSP is a Content-Security-Policy expressed as a set of sources per directive.
+type CSP map[string][]string
+
+// cspDirectiveOrder fixes the output order of directives.
+var cspDirectiveOrder = []string{
+	"default-src", "script-src", "script-src-attr", "style-src", "style-src-attr",
+	"img-src", "media-src", "font-src", "connect-src", "frame-src", "object-src",
+	"base-uri", "form-action", "frame-ancestors",
+}
+
+// cspHeaderOnlyDirectives are ignored by browsers when delivered through <meta>.
+var cspHeaderOnlyDirectives = []string{"frame-ancestors", "report-uri", "sandbox"}
+
+// NewCSP returns the baseline policy every generated page starts from.
+func NewCSP() CSP {
+	return CSP{
+		"default-src":     {"'self'"},
+		"script-src":      {"'self'"},
+		"style-src":       {"'self'"},
+		"img-src":         {"'self'", "data:"},
+		"object-src":      {"'none'"},
+		"base-uri":        {"'self'"},
+		"form-action":     {"'self'"},
+		"frame-ancestors": {"'self'"},
+	}
+}
+
+// Add appends sources to a directive, ignoring duplicates.
+func (c CSP) Add(directive string, sources ...string) {
+	for _, source := range sources {
+		if source != "" && !slices.Contains(c[directive], source) {
+			c[directive] = append(c[directive], source)
+		}
+	}
+}
+
+// Merge adds every source of other to c.
+func (c CSP) Merge(other CSP) {
+	for directive, sources := range other {
+		c.Add(directive, sources...)
+	}
+}
+
+// String serializes the policy for an HTTP header.
+func (c CSP) String() string {
+	return c.serialize(nil)
+}
+
+// MetaString serializes the policy for a <meta http-equiv> tag, omitting header-only directives.
+func (c CSP) MetaString() string {
+	return c.serialize(cspHeaderOnlyDirectives)
+}
+
+func (c CSP) serialize(skip []string) string {
+	directives := slices.Clone(cspDirectiveOrder)
+	for directive := range c {
+		if !slices.Contains(directives, directive) {
+			directives = append(directives, directive)
+		}
+	}
+	slices.Sort(directives[len(cspDirectiveOrder):])
+
+	var parts []string
+	for _, directive := range directives {
+		sources, ok := c[directive]
+		if !ok || len(sources) == 0 || slices.Contains(skip, directive) {
+			continue
+		}
+		// 'none' must be the only source of a directive.
+		if len(sources) > 1 && slices.Contains(sources, "'none'") {
+			sources = slices.DeleteFunc(slices.Clone(sources), func(s string) bool { return s == "'none'" })
+		}
+		// Browsers ignore 'unsafe-inline' when hashes are present, so drop the hashes.
+		if slices.Contains(sources, "'unsafe-inline'") {
+			sources = slices.DeleteFunc(slices.Clone(sources), func(s string) bool {
+				return strings.HasPrefix(s, "'sha")
+			})
+		}
+		parts = append(parts, directive+" "+strings.Join(sources, " "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// cspHash returns the CSP source expression for an inline script or style.
+func cspHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// cspOrigin returns the origin source for an absolute URL, "data:" for data URIs,
+// or an empty string for relative (same-origin) references.
+func cspOrigin(ref string) string {
+	ref = strings.TrimSpace(ref)
+	lower := strings.ToLower(ref)
+	switch {
+	case strings.HasPrefix(lower, "data:"):
+		return "data:"
+	case strings.HasPrefix(lower, "blob:"):
+		return "blob:"
+	case strings.HasPrefix(lower, "//"):
+		ref = "https:" + ref
+	case !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://"):
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// isExecutableScriptType reports whether a <script type> is executed by the browser.
+// Data blocks such as JSON-LD are not subject to script-src.
+func isExecutableScriptType(t string) bool {
+	switch strings.ToLower(strings.TrimSpace(t)) {
+	case "", "text/javascript", "application/javascript", "module":
+		return true
+	}
+	return false
+}
+
+// PageCSP scans a rendered HTML page and returns the policy it needs:
+// hashes of inline scripts and styles, and the origins of external resources.
+func PageCSP(htmlContent string) CSP {
+	policy := NewCSP()
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return policy
+	}
+
+	mediaDirectives := map[string]string{
+		"img": "img-src", "video": "media-src", "audio": "media-src", "source": "media-src",
+		"track": "media-src", "iframe": "frame-src", "embed": "object-src", "object": "object-src",
+	}
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			attrs := map[string]string{}
+			for _, attr := range n.Attr {
+				key := strings.ToLower(attr.Key)
+				attrs[key] = attr.Val
+				if strings.HasPrefix(key, "on") {
+					policy.Add("script-src-attr", "'unsafe-inline'")
+				}
+				if key == "style" {
+					policy.Add("style-src-attr", "'unsafe-inline'")
+				}
+				if (key == "href" || key == "src") && strings.HasPrefix(strings.ToLower(strings.TrimSpace(attr.Val)), "javascript:") {
+					policy.Add("script-src-attr", "'unsafe-inline'")
+				}
+			}
+
+			switch n.Data {
+			case "script":
+				if src, ok := attrs["src"]; ok {
+					policy.Add("script-src", cspOrigin(src))
+				} else if isExecutableScriptType(attrs["type"]) && n.FirstChild != nil {
+					policy.Add("script-src", cspHash(n.FirstChild.Data))
+				}
+			case "style":
+				if n.FirstChild != nil {
+					policy.Add("style-src", cspHash(n.FirstChild.Data))
+				}
+			case "link":
+				if strings.Contains(strings.ToLower(attrs["rel"]), "stylesheet") {
+					policy.Add("style-src", cspOrigin(attrs["href"]))
+				}
+			case "video":
+				policy.Add("img-src", cspOrigin(attrs["poster"]))
+			}
+			if directive, ok := mediaDirectives[n.Data]; ok {
+				attr := "src"
+				if n.Data == "object" {
+					attr = "data"
+				}
+				if directive == "object-src" && attrs[attr] != "" {
+					// An explicit embed replaces the baseline 'none' when serialized.
+					policy.Add("object-src", "'self'")
+				}
+				policy.Add(directive, cspOrigin(attrs[attr]))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	// MathJax injects its own <style> elements at runtime.
+	if NeedsMathJax(htmlContent) {
+		policy.Add("style-src", "'unsafe-inline'")
+	}
+	return policy
+}
+
+// InjectCSPMeta inserts a Content-Security-Policy <meta http-equiv> tag at the start of <head>.
+func InjectCSPMeta(htmlContent string, policy CSP) string {
+	// Single quotes are left as-is for readability; the attribute is double-quoted.
+	escaped := strings.NewReplacer("&", "&amp;", `"`, "&quot;", "<", "&lt;", ">", "&gt;").Replace(policy.MetaString())
+	meta := fmt.Sprintf(`<meta http-equiv="Content-Security-Policy" content="%s">`, escaped)
+	index := strings.Index(strings.ToLower(htmlContent), "<head>")
+	if index < 0 {
+		return htmlContent
+	}
+	index += len("<head>")
+	return htmlContent[:index] + "\n    " + meta + htmlContent[index:]
+}
+
+// SiteCSP scans every HTML file in the output directory and merges their policies
+// into one that can be served for the whole site.
+func SiteCSP(outputDirectory string) (CSP, error) {
+	policy := NewCSP()
+	err := filepath.WalkDir(outputDirectory, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(p), ".html") {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", p, err)
+		}
+		policy.Merge(PageCSP(string(content)))
+		return nil
+	})
+	return policy, err
+}
@@ -0,0 +1,138 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+)
+
+// SeriesDirName is the folder of the output directory holding the landing pages of series.
+const SeriesDirName = "series"
+
+// Series is a group of articles sharing a "series" frontmatter value, in reading order.
+type Series struct {
+	Name       string
+	LinkToSelf string // Landing page listing the parts, e.g. "series/go-tutorial/index.html"
+	Parts      []Article
+}
+
+// SeriesNav is what the page of a part of a series shows about the series.
+type SeriesNav struct {
+	Name       string
+	LinkToSelf string       // Landing page of the series
+	Parts      []ArticleRef // All parts, in reading order
+	Part       int          // Position of the article in Parts, from 1
+	Prev       *ArticleRef  // Previous part, or nil for the first
+	Next       *ArticleRef  // Next part, or nil for the last
+}
+
+// seriesSlug returns the folder of the landing page of the series name.
+func seriesSlug(name string) string {
+	slug := strings.ToLower(cleanString(strings.ReplaceAll(name, "/", " ")))
+	if slug == "" {
+		slug = "untitled"
+	}
+	return slug
+}
+
+// GroupSeries returns the series of articles, ordered by name, and sets the SeriesNav of
+// their parts. Parts are ordered by their "series_order" frontmatter, parts without one
+// coming last, then by creation date.
+func GroupSeries(articles []Article, settings Settings) []Series {
+	indexes := map[string][]int{}
+	var names []string // Lowercased
+	for i, article := range articles {
+		articles[i].SeriesNav = nil
+		name := strings.TrimSpace(article.Series)
+		if name == "" {
+			continue
+		}
+		key := strings.ToLower(name)
+		if _, ok := indexes[key]; !ok {
+			names = append(names, key)
+		}
+		indexes[key] = append(indexes[key], i)
+	}
+	slices.Sort(names)
+
+	var series []Series
+	slugs := map[string]string{} // Series name by slug
+	for _, key := range names {
+		parts := indexes[key]
+		slices.SortStableFunc(parts, func(a, b int) int {
+			orderA, orderB := articles[a].SeriesOrder, articles[b].SeriesOrder
+			switch {
+			case orderA != orderB && orderA != 0 && orderB != 0:
+				return orderA - orderB
+			case orderA != orderB:
+				return orderB - orderA // The part with an order comes first
+			}
+			return articles[a].Created.Compare(articles[b].Created)
+		})
+
+		// The series is named as in its first part.
+		name := strings.TrimSpace(articles[parts[0]].Series)
+		slug := seriesSlug(name)
+		for n := 2; slugs[slug] != ""; n++ {
+			slug = fmt.Sprintf("%s-%d", seriesSlug(name), n)
+		}
+		if slug != seriesSlug(name) {
+			log.Printf("Warning: Series '%s' and '%s' have the same landing page; '%s' is written to '%s'\n", slugs[seriesSlug(name)], name, name, slug)
+		}
+		slugs[slug] = name
+		s := Series{Name: name, LinkToSelf: SeriesDirName + "/" + slug + "/" + settings.IndexName}
+		refs := make([]ArticleRef, len(parts))
+		for i, index := range parts {
+			s.Parts = append(s.Parts, articles[index])
+			refs[i] = ArticleRef{Title: articles[index].Title, LinkToSelf: articles[index].LinkToSelf}
+		}
+		for i, index := range parts {
+			nav := &SeriesNav{Name: name, LinkToSelf: s.LinkToSelf, Parts: refs, Part: i + 1}
+			if i > 0 {
+				nav.Prev = &refs[i-1]
+			}
+			if i < len(refs)-1 {
+				nav.Next = &refs[i+1]
+			}
+			articles[index].SeriesNav = nav
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+// GenerateSeriesPages writes the landing page of every series, listing its parts.
+func GenerateSeriesPages(series []Series, settings Settings, tmpl *texttemplate.Template) error {
+	for _, s := range series {
+		var tp bytes.Buffer
+		err := tmpl.Execute(&tp, struct {
+			Series   Series
+			Settings Settings
+		}{
+			Series:   s,
+			Settings: settings,
+		})
+		if err != nil {
+			return fmt.Errorf("error executing series template for '%s': %w", s.Name, err)
+		}
+
+		content := tp.String()
+		if settings.CSPInMeta() {
+			content = InjectCSPMeta(content, PageCSP(content))
+		}
+
+		filePath := filepath.Join(settings.OutputPath, filepath.FromSlash(s.LinkToSelf))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for '%s': %w", filePath, err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			return fmt.Errorf("error writing series page to '%s': %w", filePath, err)
+		}
+	}
+	return nil
+}
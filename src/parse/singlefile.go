@@ -0,0 +1,173 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+
+	"golang.org/x/net/html"
+)
+
+// ReadArticle parses a Markdown or HTML source file into an Article, including the
+// metadata derived from its path and its LinkToSelf, without writing anything to the
+// output directory. It also returns the resources found by ExtractResources.
+func ReadArticle(filePath string, settings Settings) (Article, []string, error) {
+	var article Article
+	var resources []string
+	var err error
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".md":
+		article, resources, err = MarkdownFile(filePath, settings)
+	case ".html":
+		article, resources, err = HTMLFile(filePath, settings)
+	default:
+		return Article{}, nil, fmt.Errorf("unsupported file type '%s' (expected .md or .html)", filePath)
+	}
+	if err != nil {
+		return Article{}, nil, err
+	}
+	if _, err := resolveArticlePath(settings, &article); err != nil {
+		return Article{}, nil, err
+	}
+	return article, resources, nil
+}
+
+// DataURI returns the content of a file as a base64 data URI.
+func DataURI(filePath string) (string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	mediaType := mime.TypeByExtension(strings.ToLower(filepath.Ext(filePath)))
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(content), nil
+}
+
+// InlineResources returns the article's BodyContent with every local resource listed in
+// resources (images, media, scripts...) replaced by a data URI, so the content no longer
+// depends on files next to it.
+func InlineResources(article Article, resources []string, settings Settings) (string, error) {
+	return rewriteResources(article, resources, settings, DataURI)
+}
+
+// ArticleAnchor returns the fragment identifier of an article inside a document that
+// combines several articles, derived from its LinkToSelf (e.g. "posts/my-post/index.html"
+// -> "posts-my-post"). It is registered as "articleAnchor" in templates.
+func ArticleAnchor(article Article, settings Settings) string {
+	anchor := strings.TrimSuffix(article.LinkToSelf, settings.IndexName)
+	anchor = strings.TrimSuffix(strings.TrimSuffix(anchor, "/"), ".html")
+	if anchor == "" {
+		anchor = "index"
+	}
+	return strings.ReplaceAll(anchor, "/", "-")
+}
+
+// escapeRawText keeps inlined CSS or JavaScript from closing its <style> or <script> element early.
+func escapeRawText(content string, tag string) string {
+	return strings.ReplaceAll(content, "</"+tag, `<\/`+tag)
+}
+
+// SingleFileHTML renders articles into one self-contained HTML document, with the theme
+// and highlighting CSS and the site script inlined. Local resources should already be
+// embedded with InlineResources; links between the exported articles become in-page
+// anchors (see ArticleAnchor), and other links to the site are made absolute with its
+// BaseUrl, as the file is read away from the site. A single article is shown
+// under its own title; several articles are shown as sections under the site title.
+// MathJax, when needed, is embedded in offline mode and loaded from its CDN otherwise.
+func SingleFileHTML(articles []Article, settings Settings, tmpl *texttemplate.Template, assets fs.FS) ([]byte, error) {
+	var style []byte
+	var err error
+	if settings.PathToCustomCss != "" {
+		style, err = os.ReadFile(settings.PathToCustomCss)
+	} else {
+		style, err = ThemeCSS(assets, settings.Theme, settings.IgnoreErrors)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading stylesheet: %w", err)
+	}
+	highlight, err := GenerateHighlightCSS(settings.HighlightTheme)
+	if err != nil {
+		return nil, fmt.Errorf("error generating syntax highlighting CSS: %w", err)
+	}
+	var script []byte
+	if settings.PathToCustomJs != "" {
+		script, err = os.ReadFile(settings.PathToCustomJs)
+	} else {
+		script, err = fs.ReadFile(assets, "src/assets/script.js")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading script: %w", err)
+	}
+
+	targets := map[string]string{}
+	for _, article := range articles {
+		for _, key := range ArticleLinkKeys(article, settings) {
+			targets[key] = "#" + ArticleAnchor(article, settings)
+		}
+	}
+	articles = slices.Clone(articles)
+	for i := range articles {
+		body, err := RewriteInternalLinks(articles[i], articles[i].BodyContent, targets, settings)
+		if err != nil {
+			return nil, err
+		}
+		articles[i].BodyContent = body
+	}
+
+	title, description := settings.Title, settings.DescriptionHTML
+	if len(articles) == 1 {
+		title, description = articles[0].Title, template.HTML(html.EscapeString(articles[0].Description))
+	}
+
+	needsMathJax := false
+	for _, article := range articles {
+		needsMathJax = needsMathJax || article.NeedsMathJax
+	}
+	var mathJaxScript, mathJaxURL string
+	if needsMathJax {
+		if settings.Offline {
+			content, err := VendorContent(assets, "mathjax")
+			if err != nil {
+				return nil, err
+			}
+			mathJaxScript = escapeRawText(string(content), "script")
+		} else {
+			mathJaxURL = VendorURL("mathjax", "", settings)
+		}
+	}
+
+	var tp bytes.Buffer
+	err = tmpl.Execute(&tp, struct {
+		Title         string
+		Description   template.HTML
+		Articles      []Article
+		Settings      Settings
+		Style         string
+		Script        string
+		MathJaxScript string
+		MathJaxURL    string
+	}{
+		Title:         title,
+		Description:   description,
+		Articles:      articles,
+		Settings:      settings,
+		Style:         escapeRawText(string(style)+"\n"+string(highlight), "style"),
+		Script:        escapeRawText(string(script), "script"),
+		MathJaxScript: mathJaxScript,
+		MathJaxURL:    mathJaxURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error executing single-file template: %w", err)
+	}
+	return tp.Bytes(), nil
+}
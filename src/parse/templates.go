@@ -14,11 +14,16 @@ import (
 	"golang.org/x/net/html"
 )
 
-// SiteTemplates holds the pre-parsed templates for articles, index, and RSS.
+// SiteTemplates holds the pre-parsed templates for articles, index, RSS, and exports.
 type SiteTemplates struct {
-	Article *texttemplate.Template
-	Index   *texttemplate.Template
-	RSS     *texttemplate.Template
+	Article    *texttemplate.Template
+	Index      *texttemplate.Template
+	RSS        *texttemplate.Template
+	Book       *texttemplate.Template
+	Series     *texttemplate.Template
+	Gemini     *texttemplate.Template // Defines "article", "index" and "atom"
+	SingleFile *texttemplate.Template
+	Epub       *texttemplate.Template // Defines "container", "package", "nav", "cover" and "chapter"
 }
 
 // LoadTemplates parses all necessary templates from the embedded assets once at startup.
@@ -28,14 +33,19 @@ func LoadTemplates(assets fs.FS) (SiteTemplates, error) {
 	var err error
 
 	funcMap := template.FuncMap{
-		"mimeType":          MimeTypeFromFilename,
-		"genRelativeLink":   genRelativeLink,
-		"stringsJoin":       strings.Join,
-		"buildShareUrl":     BuildShareUrl,
-		"lower":             strings.ToLower,
-		"isImage":           IsImage,
-		"articleSchemaType": ArticleSchemaType,
-		"absURL":            toAbsoluteUrl,
+		"mimeType":            MimeTypeFromFilename,
+		"genRelativeLink":     genRelativeLink,
+		"stringsJoin":         strings.Join,
+		"buildShareUrl":       BuildShareUrl,
+		"lower":               strings.ToLower,
+		"isImage":             IsImage,
+		"articleSchemaType":   ArticleSchemaType,
+		"absURL":              toAbsoluteUrl,
+		"vendorURL":           VendorURL,
+		"assetPath":           assetPath,
+		"integrityAttr":       integrityAttr,
+		"vendorIntegrityAttr": vendorIntegrityAttr,
+		"articleAnchor":       ArticleAnchor,
 		"makeLink": func(title string) string {
 			return strings.ReplaceAll(strings.ToLower(title), " ", "-") + "/"
 		},
@@ -61,6 +71,10 @@ func LoadTemplates(assets fs.FS) (SiteTemplates, error) {
 			if err != nil {
 				return body
 			}
+			// Code blocks are highlighted with CSS classes; RSS readers do not load the
+			// stylesheet, so highlighter classes are converted to inline styles.
+			highlightStyles := highlightInlineStyles(s.HighlightTheme)
+
 			var f func(*html.Node)
 			f = func(n *html.Node) {
 				// 1. Tag Removal Logic: Remove scripts, styles, iframes, and UI elements.
@@ -77,7 +91,7 @@ func LoadTemplates(assets fs.FS) (SiteTemplates, error) {
 					case "img":
 						for _, attr := range n.Attr {
 							if attr.Key == "src" {
-								if strings.Contains(attr.Val, "copy.svg") || strings.Contains(attr.Val, "rss.svg") {
+								if strings.Contains(attr.Val, assetPath("copy.svg", s)) || strings.Contains(attr.Val, assetPath("rss.svg", s)) {
 									if n.Parent != nil {
 										n.Parent.RemoveChild(n)
 									}
@@ -106,12 +120,20 @@ func LoadTemplates(assets fs.FS) (SiteTemplates, error) {
 					for _, attr := range n.Attr {
 						key := strings.ToLower(attr.Key)
 
-						// 2a. Remove dirty attributes (style, class, id, events)
+						// 2a. Replace highlighter classes with equivalent inline styles
+						if key == "class" && (n.Data == "span" || n.Data == "pre") {
+							if css := inlineHighlightStyle(attr.Val, highlightStyles); css != "" {
+								newAttrs = append(newAttrs, html.Attribute{Key: "style", Val: css})
+							}
+							continue
+						}
+
+						// 2b. Remove dirty attributes (style, class, id, events)
 						if key == "style" || key == "class" || key == "id" || strings.HasPrefix(key, "on") {
 							continue
 						}
 
-						// 2b. Fix URL attributes (make absolute)
+						// 2c. Fix URL attributes (make absolute)
 						// Ensure we compare using the lowercased key to match attrName (which is lowercase)
 						if key == attrName {
 							val := strings.TrimSpace(attr.Val)
@@ -195,6 +217,36 @@ func LoadTemplates(assets fs.FS) (SiteTemplates, error) {
 		return t, fmt.Errorf("error parsing RSS template: %w", err)
 	}
 
+	// Parse book page template.
+	t.Book, err = texttemplate.New("html-book.gohtml").Funcs(funcMap).ParseFS(assets, "src/assets/templates/html-book.gohtml")
+	if err != nil {
+		return t, fmt.Errorf("error parsing book template: %w", err)
+	}
+
+	// Parse series landing page template.
+	t.Series, err = texttemplate.New("html-series.gohtml").Funcs(funcMap).ParseFS(assets, "src/assets/templates/html-series.gohtml")
+	if err != nil {
+		return t, fmt.Errorf("error parsing series template: %w", err)
+	}
+
+	// Parse Gemini capsule templates.
+	t.Gemini, err = texttemplate.New("gemini.gotmpl").Funcs(funcMap).ParseFS(assets, "src/assets/templates/gemini.gotmpl")
+	if err != nil {
+		return t, fmt.Errorf("error parsing Gemini template: %w", err)
+	}
+
+	// Parse single-file export template.
+	t.SingleFile, err = texttemplate.New("html-single.gohtml").Funcs(funcMap).ParseFS(assets, "src/assets/templates/html-single.gohtml")
+	if err != nil {
+		return t, fmt.Errorf("error parsing single-file template: %w", err)
+	}
+
+	// Parse EPUB export templates.
+	t.Epub, err = texttemplate.New("epub.goxml").Funcs(funcMap).ParseFS(assets, "src/assets/templates/epub.goxml")
+	if err != nil {
+		return t, fmt.Errorf("error parsing EPUB template: %w", err)
+	}
+
 	return t, nil
 }
 
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -200,12 +201,13 @@ func copyDirectoryRecursively(srcDir, destDir string) error {
 	})
 }
 
-// CopyHtmlResources copies associated resources for an article and determines
-// the article's output path. Resources include images and other linked assets.
-func CopyHtmlResources(settings Settings, article *Article, resources []string) error {
+// resolveArticlePath applies the metadata derived from an article's source path (dateless
+// title, folder tags), sets its LinkToSelf and LinkToSave, and returns its output file path.
+// Nothing is written to disk.
+func resolveArticlePath(settings Settings, article *Article) (string, error) {
 	relativeInputPath, err := filepath.Rel(settings.InputPath, article.OriginalPath)
 	if err != nil {
-		return fmt.Errorf("failed to get relative path for '%s': %w", article.OriginalPath, err)
+		return "", fmt.Errorf("failed to get relative path for '%s': %w", article.OriginalPath, err)
 	}
 
 	if !settings.DoNotRemoveDateFromTitles {
@@ -242,7 +244,169 @@ func CopyHtmlResources(settings Settings, article *Article, resources []string)
 			outputPath = datelessOutputPath
 		}
 	}
+	if pattern := PermalinkPatternFor(relativeInputPath, settings); pattern != "" {
+		outputPath = filepath.Join(settings.OutputPath, ExpandPermalink(pattern, relativeInputPath, article.Created, settings))
+	}
+	// The custom 404 page is served for arbitrary URLs, so it lives at a fixed name in the root.
+	if IsNotFoundSource(relativeInputPath) {
+		outputPath = filepath.Join(settings.OutputPath, NotFoundPageName)
+	}
 	outputPath = cleanString(outputPath)
+
+	linkToSelf, err := filepath.Rel(settings.OutputPath, outputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get relative link from '%s' to '%s': %w", settings.OutputPath, outputPath, err)
+	}
+	article.LinkToSelf = filepath.ToSlash(linkToSelf)
+	article.LinkToSave = filepath.ToSlash(outputPath)
+	return outputPath, nil
+}
+
+// localResourcePath returns the path, relative to the article's source folder, of a
+// resource found by ExtractResources. It reports false for external URLs, anchors and
+// other non-file links, links to other articles, and extensionless routes.
+func localResourcePath(resource string) (string, bool) {
+	resource = strings.TrimSpace(resource)
+	if resource == "" {
+		return "", false
+	}
+
+	resourceLower := strings.ToLower(resource)
+
+	// 1. Skip absolute external URLs (http/https/ftp)
+	if strings.HasPrefix(resourceLower, "http://") ||
+		strings.HasPrefix(resourceLower, "https://") ||
+		strings.HasPrefix(resourceLower, "ftp://") ||
+		strings.HasPrefix(resourceLower, "//") {
+		return "", false
+	}
+
+	// 2. Skip non-resource links (anchors, mailto, tel, sms, www., inline data)
+	if strings.HasPrefix(resourceLower, "#") ||
+		strings.HasPrefix(resourceLower, "mailto:") ||
+		strings.HasPrefix(resourceLower, "tel:") ||
+		strings.HasPrefix(resourceLower, "sms:") ||
+		strings.HasPrefix(resourceLower, "data:") ||
+		strings.HasPrefix(resourceLower, "www.") {
+		return "", false
+	}
+
+	// Strip query string and fragment, and normalize root-relative paths
+	cleanPath := resource
+	if u, err := url.Parse(resource); err == nil {
+		if u.Path != "" {
+			cleanPath = u.Path
+		} else {
+			// If path is empty (e.g. "?query" or "#anchor"), skip it
+			return "", false
+		}
+	}
+
+	// Treat leading "/" as project-root-relative, not filesystem-root
+	cleanPath = strings.TrimPrefix(cleanPath, "/")
+	if cleanPath == "" {
+		return "", false
+	}
+
+	// 3. Skip internal navigation to other source files (.md, .html)
+	// These are likely links to other posts, not assets to be copied raw.
+	ext := strings.ToLower(filepath.Ext(cleanPath))
+	if ext == ".md" || ext == ".markdown" || ext == ".html" || ext == ".htm" {
+		return "", false
+	}
+
+	// 4. Skip links without extensions (likely navigation links e.g., [About](about))
+	// Unless they are explicit file references, we assume they are internal routes.
+	if ext == "" {
+		return "", false
+	}
+	return cleanPath, true
+}
+
+// embeddedResourceAttrs lists, per element, the attributes whose local targets are part
+// of the page itself and are embedded in exports. Anchors are left alone, as they point
+// to other documents.
+var embeddedResourceAttrs = map[string][]string{
+	"img":    {"src"},
+	"script": {"src"},
+	"link":   {"href"},
+	"video":  {"src", "poster"},
+	"audio":  {"src"},
+	"source": {"src"},
+	"track":  {"src"},
+	"object": {"data"},
+	"iframe": {"src"},
+	"embed":  {"src"},
+}
+
+// rewriteResources returns the article's BodyContent with the embedded resources listed
+// in resources replaced by the result of embed, which receives the resource's source
+// path. Resources are resolved like in CopyHtmlResources, relative to the source file.
+func rewriteResources(article Article, resources []string, settings Settings, embed func(resourcePath string) (string, error)) (string, error) {
+	local := map[string]string{}
+	for _, resource := range resources {
+		if cleanPath, ok := localResourcePath(resource); ok {
+			local[resource] = cleanPath
+		}
+	}
+	if len(local) == 0 {
+		return article.BodyContent, nil
+	}
+
+	doc, err := html.Parse(strings.NewReader(article.BodyContent))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse content of '%s': %w", article.OriginalPath, err)
+	}
+
+	originalDirectory := filepath.Dir(article.OriginalPath)
+	replacements := map[string]string{}
+	var embedErr error
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, attr := range n.Attr {
+				if !slices.Contains(embeddedResourceAttrs[n.Data], attr.Key) {
+					continue
+				}
+				cleanPath, ok := local[attr.Val]
+				if !ok {
+					continue
+				}
+				replacement, ok := replacements[cleanPath]
+				if !ok {
+					resourcePath := filepath.Join(originalDirectory, cleanPath)
+					replacement, err = embed(resourcePath)
+					if err != nil {
+						if !settings.IgnoreErrors {
+							embedErr = fmt.Errorf("failed to embed resource '%s' (referenced in '%s'): %w", resourcePath, article.Title, err)
+							return
+						}
+						log.Printf("Warning: Failed to embed resource '%s' (referenced in '%s'): %v", resourcePath, article.Title, err)
+						continue
+					}
+					replacements[cleanPath] = replacement
+				}
+				n.Attr[i].Val = replacement
+			}
+		}
+		for c := n.FirstChild; c != nil && embedErr == nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+	if embedErr != nil {
+		return "", embedErr
+	}
+	return getBodyContent(doc)
+}
+
+// CopyHtmlResources copies associated resources for an article and determines
+// the article's output path. Resources include images and other linked assets.
+func CopyHtmlResources(settings Settings, article *Article, resources []string) error {
+	outputPath, err := resolveArticlePath(settings, article)
+	if err != nil {
+		return err
+	}
 	outputDirectory := filepath.Dir(outputPath)
 	if err := os.MkdirAll(outputDirectory, os.ModePerm); err != nil {
 		return fmt.Errorf("failed to create output directory '%s': %w", outputDirectory, err)
@@ -263,58 +427,9 @@ func CopyHtmlResources(settings Settings, article *Article, resources []string)
 		// but we skip the manual resource copy loop since we just copied everything.
 	} else {
 		// STANDARD CASE: Extract and copy specific resources.
-		for _, resourceOrigRelPath := range resources {
-			resourceOrigRelPath = strings.TrimSpace(resourceOrigRelPath)
-			if resourceOrigRelPath == "" {
-				continue
-			}
-
-			resourceOrigRelPathLower := strings.ToLower(resourceOrigRelPath)
-
-			// 1. Skip absolute external URLs (http/https/ftp)
-			if strings.HasPrefix(resourceOrigRelPathLower, "http://") ||
-				strings.HasPrefix(resourceOrigRelPathLower, "https://") ||
-				strings.HasPrefix(resourceOrigRelPathLower, "ftp://") ||
-				strings.HasPrefix(resourceOrigRelPathLower, "//") {
-				continue
-			}
-
-			// 2. Skip non-resource links (anchors, mailto, tel, sms, www.)
-			if strings.HasPrefix(resourceOrigRelPathLower, "#") ||
-				strings.HasPrefix(resourceOrigRelPathLower, "mailto:") ||
-				strings.HasPrefix(resourceOrigRelPathLower, "tel:") ||
-				strings.HasPrefix(resourceOrigRelPathLower, "sms:") ||
-				strings.HasPrefix(resourceOrigRelPathLower, "www.") {
-				continue
-			}
-
-			// Strip query string and fragment, and normalize root-relative paths
-			cleanPath := resourceOrigRelPath
-			if u, err := url.Parse(resourceOrigRelPath); err == nil {
-				if u.Path != "" {
-					cleanPath = u.Path
-				} else {
-					// If path is empty (e.g. "?query" or "#anchor"), skip it
-					continue
-				}
-			}
-
-			// Treat leading "/" as project-root-relative, not filesystem-root
-			cleanPath = strings.TrimPrefix(cleanPath, "/")
-			if cleanPath == "" {
-				continue
-			}
-
-			// 3. Skip internal navigation to other source files (.md, .html)
-			// These are likely links to other posts, not assets to be copied raw.
-			ext := strings.ToLower(filepath.Ext(cleanPath))
-			if ext == ".md" || ext == ".markdown" || ext == ".html" || ext == ".htm" {
-				continue
-			}
-
-			// 4. Skip links without extensions (likely navigation links e.g., [About](about))
-			// Unless they are explicit file references, we assume they are internal routes.
-			if ext == "" {
+		for _, resource := range resources {
+			cleanPath, ok := localResourcePath(resource)
+			if !ok {
 				continue
 			}
 
@@ -363,13 +478,6 @@ func CopyHtmlResources(settings Settings, article *Article, resources []string)
 		}
 	}
 
-	linkToSelf, err := filepath.Rel(settings.OutputPath, outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to get relative link from '%s' to '%s': %w", settings.OutputPath, outputPath, err)
-	}
-	article.LinkToSelf = filepath.ToSlash(linkToSelf)
-	article.LinkToSave = filepath.ToSlash(outputPath)
-
 	// If a cover image was specified, normalize its path to be relative to the article's output
 	// location so templates and Open Graph tags can reference it consistently.
 	// Only update if it was a local path.
@@ -509,6 +617,16 @@ func EncodePathSegments(path string) string {
 	return strings.Join(parts, "/")
 }
 
+// NormalizeBasePath turns a subpath deployment prefix into the form "/blog",
+// with a leading slash and no trailing slash. The site root is "".
+func NormalizeBasePath(basePath string) string {
+	basePath = strings.Trim(strings.TrimSpace(filepath.ToSlash(basePath)), "/")
+	if basePath == "" {
+		return ""
+	}
+	return path.Clean("/" + basePath)
+}
+
 // toAbsoluteUrl handles logic to prevent double-concatenation of BaseURL
 // It is used by BuildShareUrl and registered as "absURL" in templates.
 func toAbsoluteUrl(urlStr string, baseUrl string) string {
@@ -584,9 +702,9 @@ func BuildShareUrl(urlTemplate string, article Article, settings Settings) templ
 	return template.URL(result)
 }
 
-// SaveThemeCSS copies the selected theme CSS file from embedded assets to style.css in the output directory.
+// ThemeCSS returns the content of the selected theme CSS file from embedded assets.
 // If themeName is empty or invalid, it attempts to use "default.css".
-func SaveThemeCSS(assets fs.FS, themeName string, outputDirectory string, ignoreErrors bool) error {
+func ThemeCSS(assets fs.FS, themeName string, ignoreErrors bool) ([]byte, error) {
 	if themeName == "" {
 		themeName = "default"
 	}
@@ -598,7 +716,7 @@ func SaveThemeCSS(assets fs.FS, themeName string, outputDirectory string, ignore
 	if err != nil {
 		available, _ := GetAvailableThemes(assets)
 		if !ignoreErrors {
-			return fmt.Errorf("theme '%s' not found (Available: %s)", themeName, strings.Join(available, ", "))
+			return nil, fmt.Errorf("theme '%s' not found (Available: %s)", themeName, strings.Join(available, ", "))
 		}
 		log.Printf("Warning: Theme '%s' not found (Available: %s). Falling back to default theme.", themeName, strings.Join(available, ", "))
 
@@ -606,11 +724,21 @@ func SaveThemeCSS(assets fs.FS, themeName string, outputDirectory string, ignore
 		srcPath = path.Join(themesPath, "default.css")
 		fileContent, err = fs.ReadFile(assets, srcPath)
 		if err != nil {
-			return fmt.Errorf("failed to load default theme CSS: %w", err)
+			return nil, fmt.Errorf("failed to load default theme CSS: %w", err)
 		}
 	} else {
 		log.Printf("Using theme: %s", themeName)
 	}
+	return fileContent, nil
+}
+
+// SaveThemeCSS copies the selected theme CSS file from embedded assets to style.css in the output directory.
+// If themeName is empty or invalid, it attempts to use "default.css".
+func SaveThemeCSS(assets fs.FS, themeName string, outputDirectory string, ignoreErrors bool) error {
+	fileContent, err := ThemeCSS(assets, themeName, ignoreErrors)
+	if err != nil {
+		return err
+	}
 
 	if err := os.MkdirAll(outputDirectory, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory '%s': %w", outputDirectory, err)
@@ -681,6 +809,28 @@ func ParseSortOrder(s string) (SortOrder, error) {
 	}
 }
 
+// SortArticles sorts articles in place in the given order.
+func SortArticles(articles []Article, order SortOrder) {
+	switch order {
+	case SortDateCreated:
+		sort.Slice(articles, func(i, j int) bool { return articles[i].Created.After(articles[j].Created) })
+	case SortReverseDateCreated:
+		sort.Slice(articles, func(i, j int) bool { return articles[i].Created.Before(articles[j].Created) })
+	case SortDateUpdated:
+		sort.Slice(articles, func(i, j int) bool { return articles[i].Updated.After(articles[j].Updated) })
+	case SortReverseDateUpdated:
+		sort.Slice(articles, func(i, j int) bool { return articles[i].Updated.Before(articles[j].Updated) })
+	case SortTitle:
+		sort.Slice(articles, func(i, j int) bool { return articles[i].Title < articles[j].Title })
+	case SortReverseTitle:
+		sort.Slice(articles, func(i, j int) bool { return articles[i].Title > articles[j].Title })
+	case SortPath:
+		sort.Slice(articles, func(i, j int) bool { return articles[i].OriginalPath < articles[j].OriginalPath })
+	case SortReversePath:
+		sort.Slice(articles, func(i, j int) bool { return articles[i].OriginalPath > articles[j].OriginalPath })
+	}
+}
+
 // ArticleSchemaType determines which schema.org type to use for an article.
 func ArticleSchemaType(a Article) string {
 	for _, tag := range a.Tags {
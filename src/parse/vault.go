@@ -0,0 +1,215 @@
+package parse
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Vault indexes the files of the input directory, so links between Markdown files can
+// be resolved while each is rendered on its own: the page path of every article by its
+// source path, and the source paths of articles and other files by file name, which is
+// how Obsidian resolves [[wikilinks]].
+type Vault struct {
+	pages map[string]string   // LinkToSelf by source path relative to the input directory
+	notes map[string][]string // Source paths of articles by lowercased name without extension
+	files map[string][]string // Source paths of other files by lowercased name
+}
+
+// sourceCreated returns the creation date that MarkdownFile or HTMLFile would give the
+// article at filePath, needed for permalink patterns with dates.
+func sourceCreated(filePath string, settings Settings) time.Time {
+	if strings.EqualFold(filepath.Ext(filePath), ".html") {
+		if article, _, err := HTMLFile(filePath, settings); err == nil {
+			return article.Created
+		}
+	} else if source, err := os.ReadFile(filePath); err == nil {
+		if fm, _, ok, err := splitFrontmatter(source); ok && err == nil {
+			switch created := fm["created"].(type) {
+			case time.Time:
+				return created
+			case string:
+				if t, err := DateTimeFromString(created); err == nil {
+					return t
+				}
+			}
+		}
+	}
+	if t, err := DateTimeFromString(filePath); err == nil {
+		return t
+	}
+	if info, err := os.Stat(filePath); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// NewVault indexes the input directory. Hidden folders, like Obsidian's .obsidian and
+// .trash, are left out.
+func NewVault(settings Settings) (*Vault, error) {
+	v := &Vault{
+		pages: map[string]string{},
+		notes: map[string][]string{},
+		files: map[string][]string{},
+	}
+	err := filepath.WalkDir(settings.InputPath, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if strings.HasPrefix(d.Name(), ".") && filePath != settings.InputPath {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(settings.InputPath, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		name := strings.ToLower(d.Name())
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".md", ".html":
+			article := Article{OriginalPath: filePath}
+			if PermalinkPatternFor(rel, settings) != "" {
+				article.Created = sourceCreated(filePath, settings)
+			}
+			if _, err := resolveArticlePath(settings, &article); err != nil {
+				return err
+			}
+			v.pages[rel] = article.LinkToSelf
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+			v.notes[name] = append(v.notes[name], rel)
+		default:
+			v.files[name] = append(v.files[name], rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index '%s': %w", settings.InputPath, err)
+	}
+	return v, nil
+}
+
+// find returns the source path of the entry of index that a wikilink target names: by
+// file name, or by the end of its path if the target has folders. Among several matches,
+// the one in fromDir wins, then the one with the shortest path.
+func (v *Vault) find(index map[string][]string, target string, fromDir string) (string, bool) {
+	target = strings.ToLower(strings.Trim(target, "/"))
+	dir := path.Dir(target)
+	best := ""
+	for _, candidate := range index[path.Base(target)] {
+		candidateDir := path.Dir(strings.ToLower(candidate))
+		if dir != "." && candidateDir != dir && !strings.HasSuffix(candidateDir, "/"+dir) {
+			continue
+		}
+		if path.Dir(candidate) == fromDir {
+			return candidate, true
+		}
+		if best == "" || strings.Count(candidate, "/") < strings.Count(best, "/") ||
+			(strings.Count(candidate, "/") == strings.Count(best, "/") && candidate < best) {
+			best = candidate
+		}
+	}
+	return best, best != ""
+}
+
+// pageLink returns the relative link from the page of the source file from to the page
+// of the source file to.
+func (v *Vault) pageLink(from string, to string) string {
+	return genRelativeLink(v.pages[from], EncodePathSegments(v.pages[to]))
+}
+
+// fileLink returns the relative link from the source file from to the source file to,
+// as written in Markdown.
+func (v *Vault) fileLink(from string, to string) string {
+	link, err := filepath.Rel(filepath.FromSlash(path.Dir(from)), filepath.FromSlash(to))
+	if err != nil {
+		return EncodePathSegments(to)
+	}
+	return EncodePathSegments(filepath.ToSlash(link))
+}
+
+// vaultContextKey holds the vaultContext of the Markdown file being parsed.
+var vaultContextKey = parser.NewContextKey()
+
+// vaultContext is what the Markdown extensions know about the file being parsed.
+type vaultContext struct {
+	vault     *Vault
+	source    string     // Source path relative to the input directory
+	tags      []string   // Inline #tags found in the text
+	wikilinks []wikilink // Wikilinks and embeds parsed into links and images
+}
+
+// wikilink is a [[wikilink]] or ![[embed]] of the source, at span, parsed into node.
+type wikilink struct {
+	span byteRange
+	node ast.Node
+}
+
+// newParserContext returns a parser context for the Markdown file at filePath, which lets
+// links to other files of settings.Vault be resolved (see vaultLinkTransformer).
+func newParserContext(filePath string, settings Settings) parser.Context {
+	context := parser.NewContext()
+	vc := &vaultContext{vault: settings.Vault}
+	if rel, err := filepath.Rel(settings.InputPath, filePath); err == nil {
+		vc.source = filepath.ToSlash(rel)
+	}
+	if vc.vault != nil {
+		if _, ok := vc.vault.pages[vc.source]; !ok {
+			vc.vault = nil
+		}
+	}
+	context.Set(vaultContextKey, vc)
+	return context
+}
+
+// vaultContextOf returns the vaultContext of a parser context, without a vault if the
+// file is parsed without one.
+func vaultContextOf(pc parser.Context) *vaultContext {
+	if vc, ok := pc.Get(vaultContextKey).(*vaultContext); ok {
+		return vc
+	}
+	vc := &vaultContext{}
+	pc.Set(vaultContextKey, vc)
+	return vc
+}
+
+// vaultLinkTransformer points relative Markdown links to other articles' source files
+// ("other-post.md#section") to the pages of those articles.
+type vaultLinkTransformer struct{}
+
+// Transform implements parser.ASTTransformer.
+func (t *vaultLinkTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	vc := vaultContextOf(pc)
+	if vc.vault == nil {
+		return
+	}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		link, ok := n.(*ast.Link)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		u, err := url.Parse(string(link.Destination))
+		if err != nil || u.IsAbs() || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+			return ast.WalkContinue, nil
+		}
+		if ext := strings.ToLower(path.Ext(u.Path)); ext != ".md" && ext != ".html" {
+			return ast.WalkContinue, nil
+		}
+		target := path.Join(path.Dir(vc.source), u.Path)
+		if _, ok := vc.vault.pages[target]; ok {
+			link.Destination = []byte(vc.vault.pageLink(vc.source, target) + fragmentSuffix(u))
+		}
+		return ast.WalkContinue, nil
+	})
+}
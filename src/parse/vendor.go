@@ -0,0 +1,109 @@
+package parse
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// vendorPath is the directory of vendored libraries inside the embedded assets.
+var vendorPath = "src/assets/vendor"
+
+// VendorOutputDir is the output subdirectory where vendored libraries are written in offline mode.
+const VendorOutputDir = "vendor"
+
+// VendorLibrary describes a third-party browser library referenced by the templates.
+type VendorLibrary struct {
+	Name string // Key used by templates and the build.
+	CDN  string // Pinned URL referenced by online builds and downloaded by 'go generate'.
+	File string // File name under src/assets/vendor and the output's vendor directory.
+}
+
+// VendorLibraries lists the libraries that can be embedded for offline builds.
+// CDN URLs are pinned to exact versions and files, so online and offline builds load
+// the same code. MathJax is the SVG build, which, unlike the CHTML one, does not fetch
+// web fonts at runtime and so works from a single file.
+var VendorLibraries = []VendorLibrary{
+	{
+		Name: "lunr",
+		CDN:  "https://unpkg.com/lunr@2.3.9/lunr.min.js",
+		File: "lunr.min.js",
+	},
+	{
+		Name: "mathjax",
+		CDN:  "https://cdn.jsdelivr.net/npm/mathjax@3.2.2/es5/tex-mml-svg.js",
+		File: "mathjax-tex-mml-svg.js",
+	},
+}
+
+// findVendorLibrary returns the library registered under name.
+func findVendorLibrary(name string) (VendorLibrary, error) {
+	for _, lib := range VendorLibraries {
+		if lib.Name == name {
+			return lib, nil
+		}
+	}
+	return VendorLibrary{}, fmt.Errorf("unknown vendor library '%s'", name)
+}
+
+// VendorURL returns the URL a page at linkToSelf should use to load the named library:
+// the CDN URL normally, or a relative link to the vendored copy in offline mode.
+// It is registered as "vendorURL" in templates.
+func VendorURL(name string, linkToSelf string, settings Settings) string {
+	lib, err := findVendorLibrary(name)
+	if err != nil {
+		return ""
+	}
+	if settings.Offline {
+		return genRelativeLink(linkToSelf, path.Join(VendorOutputDir, lib.File))
+	}
+	return lib.CDN
+}
+
+// VendorContent returns the embedded copy of the named library.
+func VendorContent(assets fs.FS, name string) ([]byte, error) {
+	lib, err := findVendorLibrary(name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := fs.ReadFile(assets, path.Join(vendorPath, lib.File))
+	if err != nil {
+		return nil, fmt.Errorf("library '%s' is not embedded in this binary (run 'go generate ./...' before building): %w", name, err)
+	}
+	return content, nil
+}
+
+// CheckVendorLibraries returns an error if a library is missing from the embedded assets,
+// as in binaries built without running 'go generate' first.
+func CheckVendorLibraries(assets fs.FS) error {
+	for _, lib := range VendorLibraries {
+		if _, err := fs.Stat(assets, path.Join(vendorPath, lib.File)); err != nil {
+			return fmt.Errorf("library '%s' is not embedded in this binary: run 'go generate ./...' and rebuild to use -offline", lib.Name)
+		}
+	}
+	return nil
+}
+
+// SaveVendorLibrary writes the embedded copy of the named library into the output's vendor directory.
+func SaveVendorLibrary(assets fs.FS, name string, outputDirectory string) error {
+	lib, err := findVendorLibrary(name)
+	if err != nil {
+		return err
+	}
+	content, err := VendorContent(assets, name)
+	if err != nil {
+		return err
+	}
+
+	destDir := filepath.Join(outputDirectory, VendorOutputDir)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("failed to create vendor directory '%s': %w", destDir, err)
+	}
+	destPath := filepath.Join(destDir, lib.File)
+	if err := os.WriteFile(destPath, content, 0644); err != nil {
+		return fmt.Errorf("error writing vendored library '%s': %w", destPath, err)
+	}
+	return nil
+}
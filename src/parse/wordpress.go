@@ -0,0 +1,379 @@
+package parse
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/base"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/commonmark"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/strikethrough"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/table"
+	"github.com/k3a/html2text"
+	"golang.org/x/net/html"
+)
+
+// wxrItem is an entry (post, page, attachment...) of a WordPress eXtended RSS export.
+// Tags without a namespace match the wp:, content: and excerpt: elements of any WXR version.
+type wxrItem struct {
+	Title         string `xml:"title"`
+	Link          string `xml:"link"`
+	ID            string `xml:"post_id"`
+	Date          string `xml:"post_date"`
+	DateGMT       string `xml:"post_date_gmt"`
+	Modified      string `xml:"post_modified"`
+	ModifiedGMT   string `xml:"post_modified_gmt"`
+	Name          string `xml:"post_name"`
+	Status        string `xml:"status"`
+	Type          string `xml:"post_type"`
+	AttachmentURL string `xml:"attachment_url"`
+	Categories    []struct {
+		Domain string `xml:"domain,attr"`
+		Name   string `xml:",chardata"`
+	} `xml:"category"`
+	Encoded []struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	} `xml:"encoded"`
+	Meta []struct {
+		Key   string `xml:"meta_key"`
+		Value string `xml:"meta_value"`
+	} `xml:"postmeta"`
+}
+
+// wxr is the root of a WordPress export.
+type wxr struct {
+	Channel struct {
+		Link        string    `xml:"link"`
+		BaseSiteURL string    `xml:"base_site_url"`
+		BaseBlogURL string    `xml:"base_blog_url"`
+		Items       []wxrItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+// encoded returns the content:encoded or excerpt:encoded value of the item.
+func (item wxrItem) encoded(namespace string) string {
+	for _, e := range item.Encoded {
+		if strings.Contains(e.XMLName.Space, namespace) {
+			return e.Value
+		}
+	}
+	return ""
+}
+
+// wxrDate returns a WordPress date in the frontmatter format, preferring the GMT one,
+// or "" if WordPress left it unset.
+func wxrDate(gmt string, local string) string {
+	for _, date := range []string{gmt, local} {
+		if t, err := time.Parse(importDateFormat, strings.TrimSpace(date)); err == nil && t.Year() > 1 {
+			return t.Format(importDateFormat)
+		}
+	}
+	return ""
+}
+
+var (
+	// regexBlockComment matches the <!-- wp:... --> delimiters of block editor content.
+	regexBlockComment = regexp.MustCompile(`<!--\s*/?wp:[\s\S]*?-->`)
+	// regexCaption matches the [caption] shortcode wrapping an image and its caption.
+	regexCaption = regexp.MustCompile(`(?s)\[caption[^\]]*\](.*?)\[/caption\]`)
+	// regexCaptionImage splits the content of a [caption] into the (linked) image and the text.
+	regexCaptionImage = regexp.MustCompile(`(?s)^\s*((?:<a[^>]*>\s*)?<img[^>]*>(?:\s*</a>)?)(.*)$`)
+	// regexBlankLine matches the blank lines separating paragraphs.
+	regexBlankLine = regexp.MustCompile(`\n\s*\n`)
+	// regexPreBlock matches <pre> elements, whose blank lines are not paragraph breaks.
+	regexPreBlock = regexp.MustCompile(`(?is)<pre[\s>].*?</pre>`)
+	// regexBlockStart matches content starting with a block-level element.
+	regexBlockStart = regexp.MustCompile(`(?i)^<(?:p|div|h[1-6]|ul|ol|li|dl|blockquote|pre|table|figure|hr|address|section|aside|header|footer|nav|form|iframe|video|audio|style|script)[\s>/]`)
+	// regexWordPressUpload captures the path of a file under wp-content/uploads.
+	regexWordPressUpload = regexp.MustCompile(`/wp-content/uploads/(.+)$`)
+	// regexImageSize matches the -WIDTHxHEIGHT suffix of resized WordPress images.
+	regexImageSize = regexp.MustCompile(`-\d+x\d+(\.\w+)$`)
+)
+
+// wpautop adds the paragraphs that WordPress inserts when displaying classic editor
+// content: text separated by blank lines becomes <p> elements, and single newlines
+// within them line breaks. Content already starting with a block element is kept as is.
+func wpautop(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	var pres []string
+	content = regexPreBlock.ReplaceAllStringFunc(content, func(pre string) string {
+		pres = append(pres, pre)
+		return fmt.Sprintf("\x00%d\x00", len(pres)-1)
+	})
+
+	var b strings.Builder
+	for _, chunk := range regexBlankLine.Split(content, -1) {
+		chunk = strings.TrimSpace(chunk)
+		switch {
+		case chunk == "":
+			continue
+		case regexBlockStart.MatchString(chunk), strings.HasPrefix(chunk, "\x00"):
+			b.WriteString(chunk)
+		default:
+			b.WriteString("<p>" + strings.ReplaceAll(chunk, "\n", "<br>\n") + "</p>")
+		}
+		b.WriteString("\n\n")
+	}
+
+	content = b.String()
+	for i, pre := range pres {
+		content = strings.Replace(content, fmt.Sprintf("\x00%d\x00", i), pre, 1)
+	}
+	return content
+}
+
+// wordPressImporter converts the items of a WordPress export.
+type wordPressImporter struct {
+	opts        ImportOptions
+	files       *importFiles
+	siteURLs    []string          // Addresses of the WordPress site, without trailing slash
+	attachments map[string]string // Attachment URLs by post ID
+	missing     map[string]bool   // Media URLs without a local file, reported once
+	markdown    *converter.Converter
+}
+
+// localMedia returns the link, relative to the output directory, of the local copy of a
+// file uploaded to WordPress, copying it from the media directory. Resized images fall
+// back to their original when only that is available.
+func (w *wordPressImporter) localMedia(rawURL string) (string, bool) {
+	if w.opts.MediaPath == "" {
+		return "", false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	m := regexWordPressUpload.FindStringSubmatch(u.Path)
+	if m == nil {
+		return "", false
+	}
+	for _, relPath := range []string{m[1], regexImageSize.ReplaceAllString(m[1], "$1")} {
+		src := filepath.Join(w.opts.MediaPath, filepath.FromSlash(relPath))
+		if info, err := os.Stat(src); err != nil || info.IsDir() {
+			continue
+		}
+		link, err := w.files.copy(src, path.Join(ImportMediaDirName, relPath))
+		if err != nil {
+			log.Printf("Warning: %v\n", err)
+			return "", false
+		}
+		return link, true
+	}
+	if !w.missing[rawURL] {
+		w.missing[rawURL] = true
+		log.Printf("Warning: No file for '%s' in media directory '%s'\n", rawURL, w.opts.MediaPath)
+	}
+	return "", false
+}
+
+// siteLink returns the root-relative path of a link to the WordPress site, so it follows
+// the alias redirects of the imported articles wherever the blog is hosted.
+func (w *wordPressImporter) siteLink(rawURL string) (string, bool) {
+	for _, site := range w.siteURLs {
+		if rest, ok := strings.CutPrefix(rawURL, site); ok && (rest == "" || strings.ContainsAny(rest[:1], "/?#")) {
+			u, err := url.Parse(rawURL)
+			if err != nil || u.Path == "" {
+				return "", false
+			}
+			return u.RequestURI() + fragmentSuffix(u), true
+		}
+	}
+	return "", false
+}
+
+// convert returns the Markdown of WordPress post content, with uploaded files pointing to
+// their local copies and links to the old site made root-relative.
+func (w *wordPressImporter) convert(content string) (string, error) {
+	content = regexBlockComment.ReplaceAllString(content, "")
+	content = regexCaption.ReplaceAllStringFunc(content, func(caption string) string {
+		inner := regexCaption.FindStringSubmatch(caption)[1]
+		m := regexCaptionImage.FindStringSubmatch(inner)
+		if m == nil {
+			return inner
+		}
+		return "<figure>" + m[1] + "<figcaption>" + strings.TrimSpace(m[2]) + "</figcaption></figure>"
+	})
+	doc, err := html.Parse(strings.NewReader(wpautop(content)))
+	if err != nil {
+		return "", err
+	}
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			attrs := n.Attr[:0]
+			for _, attr := range n.Attr {
+				switch attr.Key {
+				case "srcset", "sizes":
+					// Other sizes of uploaded images are not copied.
+					continue
+				case "src", "href", "poster":
+					if link, ok := w.localMedia(attr.Val); ok {
+						attr.Val = link
+					} else if link, ok := w.siteLink(attr.Val); ok {
+						attr.Val = link
+					}
+				}
+				attrs = append(attrs, attr)
+			}
+			n.Attr = attrs
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	markdown, err := w.markdown.ConvertNode(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(markdown), nil
+}
+
+// article converts a published post or page of the export.
+func (w *wordPressImporter) article(item wxrItem) (importedArticle, error) {
+	name, err := url.PathUnescape(strings.TrimSpace(item.Name))
+	if err != nil || strings.ContainsAny(name, `/\`) {
+		name = ""
+	}
+	title := strings.TrimSpace(html.UnescapeString(item.Title))
+	if name == "" {
+		name = importSlug(title)
+	}
+	if name == "" {
+		name = item.Type + "-" + strings.TrimSpace(item.ID)
+	}
+	if title == "" {
+		title = name
+	}
+
+	fm := importedFrontmatter{
+		Title:   title,
+		Created: wxrDate(item.DateGMT, item.Date),
+		Updated: wxrDate(item.ModifiedGMT, item.Modified),
+	}
+	if fm.Updated == fm.Created {
+		fm.Updated = ""
+	}
+	if excerpt := strings.TrimSpace(html2text.HTML2Text(item.encoded("excerpt"))); excerpt != "" {
+		fm.Description = strings.Join(strings.Fields(excerpt), " ")
+	}
+
+	if item.Type == "page" {
+		fm.Tags = []string{"PAGE"}
+	} else {
+		for _, category := range item.Categories {
+			name := strings.TrimSpace(html.UnescapeString(category.Name))
+			if (category.Domain == "category" && name != "Uncategorized") || category.Domain == "post_tag" {
+				fm.Tags = appendTag(fm.Tags, name)
+			}
+		}
+	}
+
+	for _, meta := range item.Meta {
+		if meta.Key != "_thumbnail_id" {
+			continue
+		}
+		if cover := w.attachments[strings.TrimSpace(meta.Value)]; cover != "" {
+			fm.CoverImage = cover
+			if link, ok := w.localMedia(cover); ok {
+				fm.CoverImage = link
+			}
+		}
+	}
+
+	if u, err := url.Parse(strings.TrimSpace(item.Link)); err == nil && u.Path != "" && u.Path != "/" {
+		fm.Aliases = []string{u.Path}
+	}
+
+	body, err := w.convert(item.encoded("content"))
+	if err != nil {
+		return importedArticle{}, fmt.Errorf("failed to convert content of '%s': %w", title, err)
+	}
+	return importedArticle{Name: name, Frontmatter: fm, Body: body}, nil
+}
+
+// ImportWordPress converts the published posts and pages of a WordPress export (WXR file,
+// from Tools > Export) into Markdown files with DSBG frontmatter in opts.OutputPath.
+// Pages are tagged PAGE, categories and tags become tags, the excerpt the description and
+// the featured image the cover image. The old permalinks are kept as aliases. Nothing is
+// downloaded: if opts.MediaPath holds a copy of wp-content/uploads, the uploaded files
+// referenced are copied to the ImportMediaDirName folder and linked from there.
+func ImportWordPress(exportPath string, opts ImportOptions) (ImportReport, error) {
+	var report ImportReport
+	file, err := os.Open(exportPath)
+	if err != nil {
+		return report, fmt.Errorf("failed to open WordPress export '%s': %w", exportPath, err)
+	}
+	defer file.Close()
+
+	var export wxr
+	decoder := xml.NewDecoder(file)
+	decoder.Strict = false
+	if err := decoder.Decode(&export); err != nil {
+		return report, fmt.Errorf("failed to parse WordPress export '%s': %w", exportPath, err)
+	}
+
+	w := &wordPressImporter{
+		opts:        opts,
+		files:       newImportFiles(opts, &report),
+		attachments: map[string]string{},
+		missing:     map[string]bool{},
+		markdown: converter.NewConverter(converter.WithPlugins(
+			base.NewBasePlugin(),
+			commonmark.NewCommonmarkPlugin(),
+			strikethrough.NewStrikethroughPlugin(),
+			table.NewTablePlugin(),
+		)),
+	}
+	for _, site := range []string{export.Channel.BaseBlogURL, export.Channel.BaseSiteURL, export.Channel.Link} {
+		site = strings.TrimSuffix(strings.TrimSpace(site), "/")
+		if site != "" {
+			w.siteURLs = append(w.siteURLs, site)
+			if rest, ok := strings.CutPrefix(site, "https://"); ok {
+				w.siteURLs = append(w.siteURLs, "http://"+rest)
+			}
+		}
+	}
+	for _, item := range export.Channel.Items {
+		if item.Type == "attachment" {
+			w.attachments[strings.TrimSpace(item.ID)] = strings.TrimSpace(item.AttachmentURL)
+		}
+	}
+
+	var articles []importedArticle
+	for _, item := range export.Channel.Items {
+		if item.Type != "post" && item.Type != "page" {
+			continue
+		}
+		if item.Status != "publish" {
+			report.Skipped++
+			continue
+		}
+		article, err := w.article(item)
+		if err != nil {
+			return report, err
+		}
+		reportShortcodes(article)
+		articles = append(articles, article)
+		if item.Type == "page" {
+			report.Pages++
+		} else {
+			report.Posts++
+		}
+	}
+	if err := writeImportedArticles(articles, opts); err != nil {
+		return report, err
+	}
+	return report, nil
+}